@@ -0,0 +1,336 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  async_console.go
+ * @version: 1.0.0
+ * @Date: 2026/10/26 上午10:50
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// console config
+type ConsoleConfig struct {
+    Stderr bool // 输出到stderr，默认stdout
+    Color  int  // 0-自动（终端且未设置NO_COLOR时着色），1-总是着色，2-不着色
+}
+
+type asyncConsole struct {
+    writer     *bufio.Writer
+    color      bool
+    start      time.Time // relative timestamps since start
+    line       []byte
+    logQueue   chan logRecord
+    queueQuit  chan bool
+    errHandler ErrorHandler
+}
+
+const (
+    CONSOLE_COLOR_AUTO   int = 0 // color when writing to a terminal and NO_COLOR is not set
+    CONSOLE_COLOR_ALWAYS int = 1
+    CONSOLE_COLOR_NEVER  int = 2
+
+    colorReset = "\x1b[0m"
+    colorDim   = "\x1b[2m"
+    colorKey   = "\x1b[36m" // cyan
+)
+
+// ansi color of levels, custom levels use the nearest lower one
+var levelColors = []struct {
+    level Level
+    color string
+}{
+    {LEVEL_PANIC, "\x1b[1;35m"}, // bold magenta
+    {LEVEL_FATAL, "\x1b[1;31m"}, // bold red
+    {LEVEL_ERROR, "\x1b[31m"},   // red
+    {LEVEL_WARN, "\x1b[33m"},    // yellow
+    {LEVEL_INFO, "\x1b[32m"},    // green
+    {LEVEL_DEBUG, "\x1b[90m"},   // gray
+}
+
+// new console, w is stdout or stderr when nil
+func newAsyncConsole(s ConsoleConfig, w io.Writer, q chan logRecord, eh ErrorHandler) *asyncConsole {
+    c := new(asyncConsole)
+    c.start = time.Now()
+    c.logQueue = q
+    c.queueQuit = make(chan bool)
+    c.errHandler = eh
+
+    f := os.Stdout
+    if s.Stderr {
+        f = os.Stderr
+    }
+
+    // other writers are never terminals
+    terminal := w == nil && isTerminal(f)
+    if w == nil {
+        w = f
+    }
+    c.writer = bufio.NewWriter(w)
+
+    switch s.Color {
+    case CONSOLE_COLOR_AUTO:
+        c.color = terminal && os.Getenv("NO_COLOR") == ""
+    case CONSOLE_COLOR_ALWAYS:
+        c.color = true
+    case CONSOLE_COLOR_NEVER:
+
+    default:
+        panic("unknown console color: " + strconv.Itoa(s.Color))
+    }
+
+    go c.flushConsole()
+
+    return c
+}
+
+// character device, e.g. a terminal
+func isTerminal(f *os.File) bool {
+    fi, err := f.Stat()
+    return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// flush console, buffered lines are written when the queue is empty
+func (c *asyncConsole) flushConsole() {
+    for {
+        select {
+        case r := <-c.logQueue:
+            c.write(r)
+            if len(c.logQueue) == 0 {
+                c.flush()
+            }
+
+        case <-c.queueQuit:
+            for len(c.logQueue) > 0 {
+                c.write(<-c.logQueue)
+            }
+            c.flush()
+
+            c.errHandler(Event{Name: EVENT_QUIT, Msg: "log console is exit"})
+            c.queueQuit <- true
+            return
+        }
+    }
+}
+
+// write record as: +1.234s INFO  message key=value
+func (c *asyncConsole) write(r logRecord) {
+    if r.marker {
+        c.flush()
+        r.flush.Done()
+        return
+    }
+
+    b := c.line[:0]
+
+    b = c.appendColor(b, colorDim)
+    elapsed := "+" + r.time.Sub(c.start).Round(time.Millisecond).String()
+    for n := len(elapsed); n < 10; n++ {
+        b = append(b, ' ')
+    }
+    b = append(b, elapsed...)
+    b = c.appendColor(b, colorReset)
+    b = append(b, ' ')
+
+    b = c.appendColor(b, levelColor(r.level))
+    level := r.level.String()
+    b = append(b, level...)
+    b = c.appendColor(b, colorReset)
+    for n := len(level); n < 6; n++ {
+        b = append(b, ' ')
+    }
+
+    switch {
+    case r.msg > 0 || r.fields > 0:
+        // text record, header is replaced by the time and level above
+        b = append(b, r.data[r.msg:r.fields]...)
+        b = c.appendTextFields(b, r.data[r.fields:])
+
+    case len(r.data) > 0 && r.data[0] == '{':
+        b = c.appendJSON(b, r.data)
+
+    default:
+        b = append(b, r.data...)
+    }
+
+    b = append(b, '\n')
+    c.line = b
+
+    if _, err := c.writer.Write(b); err != nil {
+        c.errHandler(Event{Name: EVENT_FLUSH, Msg: "write console", Err: err})
+    }
+
+    r.release()
+}
+
+// fields as colored key=value, stack block dimmed
+func (c *asyncConsole) appendTextFields(b, fields []byte) []byte {
+    var stack []byte
+    if i := bytes.Index(fields, []byte("\n\t")); i >= 0 {
+        fields, stack = fields[:i], fields[i:]
+    }
+
+    for len(fields) > 0 {
+        s := bytes.TrimLeft(fields, " ")
+        eq := bytes.IndexByte(s, '=')
+        if eq <= 0 || bytes.IndexByte(s[:eq], ' ') >= 0 {
+            // not key=value, e.g. template text
+            b = append(b, fields...)
+            break
+        }
+
+        end := eq + 1 + textValueLen(s[eq+1:])
+        b = append(b, ' ', ' ')
+        b = c.appendColor(b, colorKey)
+        b = append(b, s[:eq]...)
+        b = c.appendColor(b, colorReset)
+        b = append(b, s[eq:end]...)
+        fields = s[end:]
+    }
+
+    if len(stack) > 0 {
+        b = c.appendColor(b, colorDim)
+        b = append(b, stack...)
+        b = c.appendColor(b, colorReset)
+    }
+
+    return b
+}
+
+// length of a text value, quoted values may have spaces
+func textValueLen(s []byte) int {
+    if len(s) > 0 && s[0] == '"' {
+        for i := 1; i < len(s); i++ {
+            switch s[i] {
+            case '\\':
+                i++
+            case '"':
+                return i + 1
+            }
+        }
+
+        return len(s)
+    }
+
+    if i := bytes.IndexByte(s, ' '); i >= 0 {
+        return i
+    }
+
+    return len(s)
+}
+
+// json record as caller message key=value, time and level are replaced
+func (c *asyncConsole) appendJSON(b, data []byte) []byte {
+    var (
+        doc    []json.RawMessage // key, value, key, value ...
+        msg    string
+        caller string
+        stack  string
+    )
+
+    dec := json.NewDecoder(bytes.NewReader(data))
+    if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+        return append(b, data...)
+    }
+
+    for dec.More() {
+        t, err := dec.Token()
+        if err != nil {
+            return append(b, data...)
+        }
+        key, _ := t.(string)
+
+        var value json.RawMessage
+        if err = dec.Decode(&value); err != nil {
+            return append(b, data...)
+        }
+
+        switch key {
+        case "time", "level", "pid":
+        case "msg":
+            json.Unmarshal(value, &msg)
+        case "caller":
+            json.Unmarshal(value, &caller)
+        case "stack":
+            json.Unmarshal(value, &stack)
+        default:
+            doc = append(doc, json.RawMessage(strconv.Quote(key)), value)
+        }
+    }
+
+    if caller != "" {
+        b = c.appendColor(b, colorDim)
+        b = append(b, caller...)
+        b = c.appendColor(b, colorReset)
+        b = append(b, ' ')
+    }
+    b = append(b, msg...)
+
+    for i := 0; i < len(doc); i += 2 {
+        key, _ := strconv.Unquote(string(doc[i]))
+        b = append(b, ' ', ' ')
+        b = c.appendColor(b, colorKey)
+        b = append(b, key...)
+        b = c.appendColor(b, colorReset)
+        b = append(b, '=')
+
+        var s string
+        if json.Unmarshal(doc[i+1], &s) == nil {
+            b = appendTextValue(b, s)
+        } else {
+            b = append(b, doc[i+1]...)
+        }
+    }
+
+    if stack != "" {
+        b = c.appendColor(b, colorDim)
+        b = append(b, "\n\t"...)
+        b = append(b, strings.Replace(stack, "\n", "\n\t", -1)...)
+        b = c.appendColor(b, colorReset)
+    }
+
+    return b
+}
+
+// append ansi color when enabled
+func (c *asyncConsole) appendColor(b []byte, color string) []byte {
+    if !c.color {
+        return b
+    }
+
+    return append(b, color...)
+}
+
+// color of level
+func levelColor(l Level) string {
+    for _, lc := range levelColors {
+        if l >= lc.level {
+            return lc.color
+        }
+    }
+
+    return levelColors[len(levelColors)-1].color
+}
+
+// flush buffered lines
+func (c *asyncConsole) flush() {
+    if err := c.writer.Flush(); err != nil {
+        c.errHandler(Event{Name: EVENT_FLUSH, Msg: "write console", Err: err})
+    }
+}
+
+// quite
+func (c *asyncConsole) SignQuite() bool {
+    c.queueQuit <- true
+    return <-c.queueQuit
+}
@@ -9,40 +9,47 @@
 package asynclog
 
 import (
-    "bufio"
     "fmt"
+    "net"
     "os"
-    "sync"
     "time"
 )
 
 type asyncFile struct {
-    FileDir    string     // file full path
-    SplitType  int        // split log type: 0-no 1-split by day 2-split by hour
-    buffer     *BufferLog // log buffer
-    BufferSize int        // log buffer size
-    file       *os.File   // *os.file
-    logTime    int        // last flush log success time
-    logQueue   chan []byte
-}
-
-type BufferLog struct {
-    B *bufio.Writer
-    sync.Mutex
+    FileDir    string        // file full path
+    SplitType  int           // split log type: 0-no 1-split by day 2-split by hour
+    BufferSize int           // bytes of records written in one writev
+    Interval   time.Duration // flush interval
+    file       *os.File      // *os.file
+    logTime    int           // last flush log success time
+    syncer     fileSyncer    // durability of file
+    records    []logRecord   // records waiting to be written, released after writev
+    lines      net.Buffers   // lines of records, reused by every writev
+    batchBytes int
+    flushNow   bool          // batch has records at or above flush level
+    logQueue   chan logRecord
+    queueQuit  chan bool
+    errHandler ErrorHandler
 }
 
 const (
     SPLIT_LOG_TYPE_NORMAL int = 0 // no split file
     SPLIT_LOG_TYPE_DAY    int = 1 // split by day
     SPLIT_LOG_TYPE_HOUR   int = 2 // split by hour
+
+    fileRetryInterval = 100 * time.Millisecond
 )
 
-func newAsyncFile(fileDir string, splitType, bufferSize int, q chan []byte) *asyncFile {
+func newAsyncFile(s LogConfig, q chan logRecord, eh ErrorHandler) *asyncFile {
     al := new(asyncFile)
-    al.FileDir = fileDir
-    al.SplitType = splitType
-    al.BufferSize = bufferSize
+    al.FileDir = s.FileFullPath
+    al.SplitType = s.SplitLogType
+    al.BufferSize = s.BufferSize
+    al.Interval = s.FlushInterval
+    al.syncer = newFileSyncer(s)
     al.logQueue = q
+    al.queueQuit = make(chan bool)
+    al.errHandler = eh
 
     al.check()
 
@@ -51,10 +58,7 @@ func newAsyncFile(fileDir string, splitType, bufferSize int, q chan []byte) *asy
         panic("open file:" + fileFullPath + " error: " + err.Error())
     }
 
-    al.NewBuffer()
-
     go al.TickerWriteBuffer()
-    go al.TickerFlushBuffer()
 
     return al
 }
@@ -67,87 +71,132 @@ func (c *asyncFile) check() {
     if c.BufferSize == 0 {
         c.BufferSize = 1 * 1024 * 1024
     }
+
+    if c.Interval <= 0 {
+        c.Interval = 1 * time.Second
+    }
 }
 
-// ticker write buffer
+// group commit: take all queued records at once and write them with one writev
+// when over buffer size, at flush level or every interval
 func (c *asyncFile) TickerWriteBuffer() {
-    var (
-        err error
-    )
+    ticker := time.NewTicker(c.Interval)
+    defer ticker.Stop()
 
     for {
         select {
-        case data := <-c.logQueue:
-            var tryTimes = 1
-            for {
-                fileDir, needSplit := c.SplitFileFullPath()
-                if needSplit {
-                    c.buffer.Lock()
-                    if c.buffer.B.Buffered() > 0 {
-                        c.buffer.B.Flush()
-                    }
-                    c.buffer.Unlock()
-
-                    c.OpenFile(fileDir)
-                    c.NewBuffer()
-                }
-
-                br := []byte("\n")
-                for i := 0; i < len(br); i++ {
-                    data = append(data, br[i])
-                }
-
-                c.buffer.Lock()
-                if c.buffer.B.Buffered()+len(data) > c.BufferSize {
-                    err = c.buffer.B.Flush()
-                    if err != nil {
-                        // retry 10 times reopen file
-                        if tryTimes == 10 {
-                            c.OpenFile(fileDir)
-                            c.NewBuffer()
-                        }
-                        tryTimes++
-                        c.buffer.Unlock()
-                        continue
-                    }
-                }
-
-                c.buffer.B.Write(data)
-                c.buffer.Unlock()
-
-                break
+        case r := <-c.logQueue:
+            c.push(r)
+
+            // only this goroutine reads the queue, so it never blocks here
+            for c.batchBytes < c.BufferSize && len(c.logQueue) > 0 {
+                c.push(<-c.logQueue)
             }
-        }
-    }
 
-}
+            if c.batchBytes >= c.BufferSize || c.flushNow {
+                c.FlushBuffer()
+            }
 
-// ticker flush buffer
-func (c *asyncFile) TickerFlushBuffer() {
-    ticker := time.Tick(1 * time.Second)
+        case <-ticker.C:
+            c.FlushBuffer()
+
+            if err := c.syncer.tick(c.file); err != nil {
+                c.errHandler(Event{Name: EVENT_FLUSH, Msg: "fsync " + c.FileDir, Err: err})
+            }
+
+        case <-c.queueQuit:
+            for len(c.logQueue) > 0 {
+                c.push(<-c.logQueue)
+            }
 
-    for {
-        select {
-        case <-ticker:
             c.FlushBuffer()
+            c.CloseFile()
+
+            c.errHandler(Event{Name: EVENT_QUIT, Msg: "log queue is exit"})
+            c.queueQuit <- true
+            return
         }
     }
 }
 
-// create newAsyncFile buffer
-func (c *asyncFile) NewBuffer() {
-    c.buffer = &BufferLog{
-        B: bufio.NewWriterSize(c.file, c.BufferSize),
+// add record to batch, write the batch to the old file before split
+// write and fsync the batch for flush markers
+func (c *asyncFile) push(r logRecord) {
+    if r.marker {
+        c.FlushBuffer()
+
+        if err := c.syncer.force(c.file); err != nil {
+            c.errHandler(Event{Name: EVENT_FLUSH, Msg: "fsync " + c.FileDir, Err: err})
+        }
+
+        r.flush.Done()
+        return
     }
+
+    if fileDir, needSplit := c.SplitFileFullPath(); needSplit {
+        c.FlushBuffer()
+
+        if err := c.OpenFile(fileDir); err != nil {
+            c.errHandler(Event{Name: EVENT_ROTATE, Msg: fileDir, Err: err})
+        } else {
+            c.errHandler(Event{Name: EVENT_ROTATE, Msg: fileDir})
+        }
+    }
+
+    c.records = append(c.records, r)
+    c.batchBytes += len(r.data) + 1
+    c.flushNow = c.flushNow || r.flush != nil
 }
 
-// flush buffer
+// write batch with writev, retry until written and reopen file every 10 failures
 func (c *asyncFile) FlushBuffer() {
-    c.buffer.Lock()
-    defer c.buffer.Unlock()
-    if c.buffer.B.Buffered() > 0 {
-        c.buffer.B.Flush()
+    if len(c.records) == 0 {
+        return
     }
+
+    lines := c.lines[:0]
+    for _, r := range c.records {
+        lines = append(lines, r.line())
+    }
+    c.lines = lines
+
+    var written int64
+    for tryTimes := 1; ; tryTimes++ {
+        n, err := writeBuffers(c.file, &lines)
+        written += n
+        if err == nil {
+            break
+        }
+
+        c.errHandler(Event{Name: EVENT_FLUSH, Msg: c.FileDir, Err: err})
+
+        if tryTimes%10 == 0 {
+            c.errHandler(Event{Name: EVENT_REOPEN, Msg: c.FileDir, Err: c.OpenFile(c.file.Name())})
+        }
+
+        time.Sleep(fileRetryInterval)
+    }
+
+    err := c.syncer.wrote(c.file, int(written))
+    if err == nil && c.flushNow {
+        err = c.syncer.sync(c.file)
+    }
+
+    if err != nil {
+        c.errHandler(Event{Name: EVENT_FLUSH, Msg: "fsync " + c.FileDir, Err: err})
+    }
+
+    for i, r := range c.records {
+        if r.flush != nil {
+            r.flush.Done()
+        }
+        r.release()
+        c.records[i] = logRecord{}
+        c.lines[i] = nil
+    }
+    c.records = c.records[:0]
+    c.batchBytes = 0
+    c.flushNow = false
 }
 
 // get file full path
@@ -190,7 +239,7 @@ func (c *asyncFile) SplitFileFullPath() (string, bool) {
 func (c *asyncFile) OpenFile(fileDir string) (err error) {
     var f *os.File
 
-    if f, err = os.OpenFile(fileDir, os.O_RDWR|os.O_SYNC|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+    if f, err = c.syncer.open(fileDir); err != nil {
         return err
     }
 
@@ -201,37 +250,21 @@ func (c *asyncFile) OpenFile(fileDir string) (err error) {
     return nil
 }
 
-// close file
+// fsync and close file
 func (c *asyncFile) CloseFile() error {
-    if c.file != nil {
-        return c.file.Close()
+    if c.file == nil {
+        return nil
     }
 
-    return nil
+    if err := c.syncer.sync(c.file); err != nil {
+        c.errHandler(Event{Name: EVENT_FLUSH, Msg: "fsync " + c.FileDir, Err: err})
+    }
+
+    return c.file.Close()
 }
 
 // quite
 func (c *asyncFile) SignQuite() bool {
-    var (
-        l      int
-        ticker = time.Tick(100 * time.Millisecond)
-    )
-
-    for {
-        select {
-        case <-ticker:
-            c.FlushBuffer()
-
-            l = len(c.logQueue)
-            fmt.Printf("log queue have log: %d ,wait exit\n", l)
-            if l == 0 {
-                c.CloseFile()
-                goto END
-            }
-        }
-    }
-
-END:
-    fmt.Println("log queue is exit")
-    return true
+    c.queueQuit <- true
+    return <-c.queueQuit
 }
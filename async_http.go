@@ -0,0 +1,351 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  async_http.go
+ * @version: 1.0.0
+ * @Date: 2026/10/19 下午2:05
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "bytes"
+    "compress/gzip"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// http config
+type HttpConfig struct {
+    Url           string            // 接收地址，如 http://127.0.0.1:9200/_bulk、http://127.0.0.1:3100/loki/api/v1/push
+    Format        int               // 发送格式 0-每行一条json，1-elasticsearch _bulk，2-loki push
+    BatchSize     int               // 每批最大条数，默认1000
+    BatchInterval time.Duration     // 不足一批时的发送间隔，默认1s
+    Gzip          bool              // 是否gzip压缩请求体
+    Headers       map[string]string // 自定义请求头，如 Authorization
+    MaxRetries    int               // 失败重试次数，默认3
+    Timeout       time.Duration     // 请求超时时间，默认5s
+    Index         string            // elasticsearch index，默认asynclog
+    Labels        map[string]string // loki stream labels，默认 {app="asynclog"}，level会自动加入label
+}
+
+type asyncHttp struct {
+    url           string
+    format        int
+    batchSize     int
+    batchInterval time.Duration
+    gzip          bool
+    headers       map[string]string
+    maxRetries    int
+    index         string
+    labels        map[string]string
+    client        *http.Client
+    logQueue      chan logRecord
+    queueQuit     chan bool
+    errHandler    ErrorHandler
+}
+
+// generic json / elasticsearch document
+type httpDoc struct {
+    Time      string `json:"time,omitempty"`
+    Timestamp string `json:"@timestamp,omitempty"`
+    Level     string `json:"level"`
+    Message   string `json:"message"`
+}
+
+// loki push body
+type lokiPush struct {
+    Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+    Stream map[string]string `json:"stream"`
+    Values [][2]string       `json:"values"`
+}
+
+const (
+    HTTP_FORMAT_JSON    int = 0 // newline delimited json
+    HTTP_FORMAT_ES_BULK int = 1 // elasticsearch _bulk
+    HTTP_FORMAT_LOKI    int = 2 // loki push api
+)
+
+// new http
+func newAsyncHttp(s HttpConfig, q chan logRecord, eh ErrorHandler) *asyncHttp {
+    c := new(asyncHttp)
+    c.url = s.Url
+    c.format = s.Format
+    c.batchSize = s.BatchSize
+    c.batchInterval = s.BatchInterval
+    c.gzip = s.Gzip
+    c.headers = s.Headers
+    c.maxRetries = s.MaxRetries
+    c.index = s.Index
+    c.labels = s.Labels
+    c.client = &http.Client{Timeout: s.Timeout}
+    c.logQueue = q
+    c.queueQuit = make(chan bool)
+    c.errHandler = eh
+
+    c.check()
+
+    go c.flushHttp()
+
+    return c
+}
+
+// check param
+func (c *asyncHttp) check() {
+    if c.url == "" {
+        panic("http url is empty")
+    }
+
+    if c.batchSize <= 0 {
+        c.batchSize = 1000
+    }
+
+    if c.batchInterval <= 0 {
+        c.batchInterval = 1 * time.Second
+    }
+
+    if c.maxRetries <= 0 {
+        c.maxRetries = 3
+    }
+
+    if c.client.Timeout <= 0 {
+        c.client.Timeout = 5 * time.Second
+    }
+
+    if c.index == "" {
+        c.index = "asynclog"
+    }
+
+    if len(c.labels) == 0 {
+        c.labels = map[string]string{"app": "asynclog"}
+    }
+}
+
+// flush http
+func (c *asyncHttp) flushHttp() {
+    ticker := time.NewTicker(c.batchInterval)
+    defer ticker.Stop()
+
+    batch := make([]logRecord, 0, c.batchSize)
+
+    for {
+        select {
+        case r := <-c.logQueue:
+            if r.marker {
+                if len(batch) > 0 {
+                    c.send(batch)
+                    batch = batch[:0]
+                }
+
+                r.flush.Done()
+                continue
+            }
+
+            batch = append(batch, r.detach())
+            if len(batch) >= c.batchSize {
+                c.send(batch)
+                batch = batch[:0]
+            }
+
+        case <-ticker.C:
+            if len(batch) > 0 {
+                c.send(batch)
+                batch = batch[:0]
+            }
+
+        case <-c.queueQuit:
+            for len(c.logQueue) > 0 {
+                r := <-c.logQueue
+                if r.marker {
+                    if len(batch) > 0 {
+                        c.send(batch)
+                        batch = batch[:0]
+                    }
+
+                    r.flush.Done()
+                    continue
+                }
+
+                batch = append(batch, r.detach())
+                if len(batch) >= c.batchSize {
+                    c.send(batch)
+                    batch = batch[:0]
+                }
+            }
+
+            if len(batch) > 0 {
+                c.send(batch)
+            }
+
+            c.errHandler(Event{Name: EVENT_QUIT, Msg: "log http is exit"})
+            c.queueQuit <- true
+            return
+        }
+    }
+}
+
+// send batch, retry with backoff when failed
+func (c *asyncHttp) send(batch []logRecord) {
+    body, err := c.encode(batch)
+    if err != nil {
+        c.errHandler(Event{Name: EVENT_HTTP_SEND, Msg: fmt.Sprintf("encode %d records", len(batch)), Err: err})
+        return
+    }
+
+    var (
+        retry   bool
+        backoff = 200 * time.Millisecond
+    )
+
+    for i := 0; i <= c.maxRetries; i++ {
+        if i > 0 {
+            time.Sleep(backoff)
+            backoff *= 2
+        }
+
+        if retry, err = c.post(body); err == nil {
+            return
+        }
+
+        c.errHandler(Event{Name: EVENT_HTTP_SEND, Msg: fmt.Sprintf("post %s, try %d", c.url, i+1), Err: err})
+        if !retry {
+            break
+        }
+    }
+
+    c.errHandler(Event{Name: EVENT_HTTP_SEND, Msg: fmt.Sprintf("drop %d records", len(batch)), Err: err})
+}
+
+// post body, returns whether the failure is worth retrying
+func (c *asyncHttp) post(body []byte) (bool, error) {
+    var reader io.Reader = bytes.NewReader(body)
+
+    if c.gzip {
+        var buf bytes.Buffer
+        zw := gzip.NewWriter(&buf)
+        zw.Write(body)
+        zw.Close()
+        reader = &buf
+    }
+
+    req, err := http.NewRequest(http.MethodPost, c.url, reader)
+    if err != nil {
+        return false, err
+    }
+
+    if c.format == HTTP_FORMAT_LOKI {
+        req.Header.Set("Content-Type", "application/json")
+    } else {
+        req.Header.Set("Content-Type", "application/x-ndjson")
+    }
+
+    if c.gzip {
+        req.Header.Set("Content-Encoding", "gzip")
+    }
+
+    for k, v := range c.headers {
+        req.Header.Set(k, v)
+    }
+
+    resp, err := c.client.Do(req)
+    if err != nil {
+        return true, err
+    }
+    defer resp.Body.Close()
+
+    respBody, _ := ioutil.ReadAll(resp.Body)
+
+    if resp.StatusCode/100 != 2 {
+        err = fmt.Errorf("http status %d: %s", resp.StatusCode, respBody)
+        return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+    }
+
+    if c.format == HTTP_FORMAT_ES_BULK {
+        var bulk struct {
+            Errors bool `json:"errors"`
+        }
+
+        if json.Unmarshal(respBody, &bulk) == nil && bulk.Errors {
+            return false, fmt.Errorf("elasticsearch bulk has errors: %s", respBody)
+        }
+    }
+
+    return false, nil
+}
+
+// encode batch to request body
+func (c *asyncHttp) encode(batch []logRecord) ([]byte, error) {
+    var buf bytes.Buffer
+
+    switch c.format {
+    case HTTP_FORMAT_LOKI:
+        streams := make(map[Level]*lokiStream)
+        push := lokiPush{}
+
+        for _, r := range batch {
+            stream, ok := streams[r.level]
+            if !ok {
+                stream = &lokiStream{Stream: map[string]string{"level": r.level.String()}}
+                for k, v := range c.labels {
+                    stream.Stream[k] = v
+                }
+                streams[r.level] = stream
+            }
+
+            stream.Values = append(stream.Values, [2]string{strconv.FormatInt(r.time.UnixNano(), 10), string(r.data)})
+        }
+
+        for _, stream := range streams {
+            push.Streams = append(push.Streams, *stream)
+        }
+
+        return json.Marshal(push)
+
+    case HTTP_FORMAT_ES_BULK:
+        action, err := json.Marshal(map[string]map[string]string{"index": {"_index": c.index}})
+        if err != nil {
+            return nil, err
+        }
+
+        enc := json.NewEncoder(&buf)
+        for _, r := range batch {
+            buf.Write(action)
+            buf.WriteByte('\n')
+            if err = enc.Encode(httpDoc{
+                Timestamp: r.time.Format(time.RFC3339Nano),
+                Level:     r.level.String(),
+                Message:   string(r.data),
+            }); err != nil {
+                return nil, err
+            }
+        }
+
+    default:
+        enc := json.NewEncoder(&buf)
+        for _, r := range batch {
+            if err := enc.Encode(httpDoc{
+                Time:    r.time.Format(time.RFC3339Nano),
+                Level:   r.level.String(),
+                Message: string(r.data),
+            }); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    return buf.Bytes(), nil
+}
+
+// quite
+func (c *asyncHttp) SignQuite() bool {
+    c.queueQuit <- true
+    return <-c.queueQuit
+}
@@ -12,6 +12,9 @@ package asynclog
 import (
     "fmt"
     "github.com/Shopify/sarama"
+    "strconv"
+    "strings"
+    "sync"
     "time"
 )
 
@@ -20,16 +23,33 @@ type asyncKafka struct {
     brokers         []string
     topic           string
     version         string
+    kafkaVersion    sarama.KafkaVersion
     compression     int
     requiredAcks    int
     MaxMessageBytes int
-    logQueue        chan []byte
-    isQuit          bool
+    logQueue        chan logRecord
+    isQuit          bool          // quit received, only used by the flush goroutine
+    seq             uint64        // sequence of the last message
+    inflight        int           // messages not acked or dropped yet, including retries in queue
+    flushes         []*kafkaFlush // Flush markers waiting for acks
     queueQuit       chan bool
+    errHandler      ErrorHandler
 }
 
+// Flush marker waiting for messages sent before it
+type kafkaFlush struct {
+    seq       uint64 // last message before the marker
+    remaining int    // messages before the marker not acked or dropped yet
+    wg        *sync.WaitGroup
+}
+
+const (
+    KAFKA_VERSION_AUTO string = "auto" // detect broker version at startup
+)
+
 // new kafka
-func newAsyncKafka(brokers []string, topic, version string, compression, acks, maxMessageBytes int, q chan []byte) *asyncKafka {
+func newAsyncKafka(brokers []string, topic, version string, compression, acks, maxMessageBytes int, q chan logRecord,
+    eh ErrorHandler) *asyncKafka {
 
     c := new(asyncKafka)
     c.brokers = brokers
@@ -39,6 +59,8 @@ func newAsyncKafka(brokers []string, topic, version string, compression, acks, m
     c.requiredAcks = acks
     c.MaxMessageBytes = maxMessageBytes
     c.logQueue = q
+    c.queueQuit = make(chan bool)
+    c.errHandler = eh
 
     c.check()
 
@@ -62,81 +84,147 @@ func (c *asyncKafka) check() {
     if c.MaxMessageBytes == 0 {
         c.MaxMessageBytes = 1 * 1024 * 1024
     }
+
+    if c.version != KAFKA_VERSION_AUTO {
+        var err error
+        if c.kafkaVersion, err = kafkaVersion(c.version); err != nil {
+            panic("kafka version error: " + err.Error())
+        }
+    }
 }
 
 // kafka client
 func (c *asyncKafka) client() {
     var err error
+
+    if c.version == KAFKA_VERSION_AUTO {
+        if c.kafkaVersion, err = detectKafkaVersion(c.brokers); err != nil {
+            c.errHandler(Event{Name: EVENT_KAFKA_INIT, Msg: "detect kafka version failed, use " + c.kafkaVersion.String(), Err: err})
+        }
+    }
+
     config := sarama.NewConfig()
     config.Producer.RequiredAcks = kafkaRequiredAcks(c.requiredAcks)
     config.Producer.Partitioner = sarama.NewRandomPartitioner
     config.Producer.Return.Successes = true
     config.Producer.Return.Errors = true
-    config.Version = kafkaVersion(c.version)
+    config.Version = c.kafkaVersion
     config.Metadata.RefreshFrequency = 60 * time.Second
     config.Producer.MaxMessageBytes = c.MaxMessageBytes
     config.Producer.Compression = kafkaCompression(c.compression)
 
-    fmt.Printf("kafka init: kafka verison:%s host:%+v requiredAcks:%d",
-        c.version, c.brokers, c.requiredAcks)
-
     c.producer, err = sarama.NewAsyncProducer(c.brokers, config)
     if err != nil {
         panic("client kafka error: " + err.Error())
     }
+
+    c.errHandler(Event{
+        Name: EVENT_KAFKA_INIT,
+        Msg:  fmt.Sprintf("kafka version:%s host:%+v requiredAcks:%d", c.kafkaVersion, c.brokers, c.requiredAcks),
+    })
 }
 
 // flush kafka
 func (c *asyncKafka) flushKafka() {
     defer c.producer.AsyncClose()
 
-    var logBody []byte
+    var r logRecord
     for {
+        // quit when every queued message is acked or dropped
+        if c.isQuit && len(c.logQueue) == 0 && c.inflight == 0 {
+            break
+        }
+
         select {
-        case logBody = <-c.logQueue:
+        case <-c.queueQuit:
+            c.isQuit = true
+
+        case r = <-c.logQueue:
+            if r.marker {
+                if c.inflight == 0 {
+                    r.flush.Done()
+                } else {
+                    c.flushes = append(c.flushes, &kafkaFlush{seq: c.seq, remaining: c.inflight, wg: r.flush})
+                }
+                continue
+            }
+
+            // retried messages keep their sequence
+            if r.id == 0 {
+                c.seq++
+                r.id = c.seq
+                c.inflight++
+            }
+
+            // sarama holds the message until acked
+            r = r.detach()
             msg := &sarama.ProducerMessage{
-                Topic: c.topic,
-                Value: sarama.ByteEncoder(string(logBody)),
+                Topic:    c.topic,
+                Value:    sarama.ByteEncoder(r.data),
+                Metadata: r,
             }
 
             c.producer.Input() <- msg
 
         case msg := <-c.producer.Successes():
-            data, err := msg.Value.Encode()
             // send success
-            fmt.Printf("send kafka success | data: %v | topic: %s | offset: %d | partition: %d | error: %v", string(data), msg.Topic, msg.Offset, msg.Partition, err)
-            if c.isQuit && len(c.logQueue) == 0 {
-                goto END
-            }
+            c.finish(msg.Metadata.(logRecord))
 
         case kafkaErr := <-c.producer.Errors():
-            msg, _ := kafkaErr.Msg.Value.Encode()
+            // the payload is not reported, a broker outage would echo every record to the handler
+            size := strconv.Itoa(kafkaErr.Msg.Value.Length())
             // send failed
-            //fmt.Printf("send kafka error: %s | data: %s ", kafkaErr.Error(), string(msg))
             if c.isQuit {
-                // send failed, write screen when sign quite
-                fmt.Println("log queue is exit, send kafka error: ", kafkaErr.Error(), " message: ", string(msg))
-
-                if len(c.logQueue) == 0 {
-                    goto END
-                }
+                // send failed, report the dropped message when sign quite
+                c.errHandler(Event{Name: EVENT_KAFKA_SEND, Msg: "log queue is exit, drop message of " + size + " bytes", Err: kafkaErr.Err})
+                c.finish(kafkaErr.Msg.Metadata.(logRecord))
 
             } else {
                 // send failed, retry
-                c.logQueue <- msg
+                // never block on own queue, drop when it is full
+                select {
+                case c.logQueue <- kafkaErr.Msg.Metadata.(logRecord):
+                    c.errHandler(Event{Name: EVENT_KAFKA_SEND, Msg: "retry message of " + size + " bytes", Err: kafkaErr.Err})
+                default:
+                    c.errHandler(Event{Name: EVENT_KAFKA_SEND, Msg: "log queue is full, drop message of " + size + " bytes", Err: kafkaErr.Err})
+                    c.finish(kafkaErr.Msg.Metadata.(logRecord))
+                }
             }
         }
     }
 
-END:
-    fmt.Println("log kafka is exit")
+    for _, f := range c.flushes {
+        f.wg.Done()
+    }
+    c.flushes = nil
+
+    c.errHandler(Event{Name: EVENT_QUIT, Msg: "log kafka is exit"})
     c.queueQuit <- true
     return
 }
 
+// message acked or dropped, done Flush markers waiting for it
+func (c *asyncKafka) finish(r logRecord) {
+    c.inflight--
+
+    flushes := c.flushes[:0]
+    for _, f := range c.flushes {
+        if r.id <= f.seq {
+            f.remaining--
+        }
+
+        if f.remaining == 0 {
+            f.wg.Done()
+        } else {
+            flushes = append(flushes, f)
+        }
+    }
+    c.flushes = flushes
+}
+
 // quite
 func (c *asyncKafka) SignQuite() bool {
-    c.isQuit = true
+    c.queueQuit <- true
     return <-c.queueQuit
 }
 
@@ -173,39 +261,78 @@ func kafkaRequiredAcks(k int) sarama.RequiredAcks {
 }
 
 // kafka version
-func kafkaVersion(v string) sarama.KafkaVersion {
-    var (
-        kafkaVersionMap = map[string]sarama.KafkaVersion{
-            "0.8.2.0":  sarama.V0_8_2_0,
-            "0.8.2.1":  sarama.V0_8_2_1,
-            "0.8.2.2":  sarama.V0_8_2_2,
-            "0.9.0.0":  sarama.V0_9_0_0,
-            "0.9.0.1":  sarama.V0_9_0_1,
-            "0.10.0.0": sarama.V0_10_0_0,
-            "0.10.0.1": sarama.V0_10_0_1,
-            "0.10.1.0": sarama.V0_10_1_0,
-            "0.10.1.1": sarama.V0_10_1_1,
-            "0.10.2.0": sarama.V0_10_2_0,
-            "0.10.2.1": sarama.V0_10_2_1,
-            "0.11.0.0": sarama.V0_11_0_0,
-            "0.11.0.1": sarama.V0_11_0_1,
-            "0.11.0.2": sarama.V0_11_0_2,
-            "1.0.0.0":  sarama.V1_0_0_0,
-            "1.1.0.0":  sarama.V1_1_0_0,
-            "1.1.1.0":  sarama.V1_1_1_0,
-            "2.0.0.0":  sarama.V2_0_0_0,
-            "2.0.1.0":  sarama.V2_0_1_0,
-            "2.1.0.0":  sarama.V2_1_0_0,
-            "2.2.0.0":  sarama.V2_2_0_0,
-            "2.3.0.0":  sarama.V2_3_0_0,
-            "2.4.0.0":  sarama.V2_4_0_0,
-            "2.5.0.0":  sarama.V2_5_0_0,
+// accepts 0.x.y.z and x.y.z (x.y.z.0 is also allowed for compatibility), empty is the latest supported version
+func kafkaVersion(v string) (sarama.KafkaVersion, error) {
+    if v == "" {
+        return sarama.MaxVersion, nil
+    }
+
+    if parts := strings.Split(v, "."); len(parts) == 4 && parts[0] != "0" && parts[3] == "0" {
+        v = strings.Join(parts[:3], ".")
+    }
+
+    return sarama.ParseKafkaVersion(v)
+}
+
+// detect kafka version by the max produce api version the broker supports
+func detectKafkaVersion(brokers []string) (sarama.KafkaVersion, error) {
+    var lastErr error
+
+    config := sarama.NewConfig()
+    config.Version = sarama.V0_10_0_0
+
+    for _, addr := range brokers {
+        broker := sarama.NewBroker(addr)
+        if err := broker.Open(config); err != nil {
+            lastErr = err
+            continue
         }
-    )
 
-    if vs, ok := kafkaVersionMap[v]; ok {
-        return vs
+        resp, err := broker.ApiVersions(&sarama.ApiVersionsRequest{})
+        broker.Close()
+        if err != nil {
+            lastErr = err
+            continue
+        }
+
+        if resp.Err != sarama.ErrNoError {
+            lastErr = resp.Err
+            continue
+        }
+
+        for _, block := range resp.ApiVersions {
+            if block.ApiKey == 0 {
+                return kafkaVersionByProduce(block.MaxVersion), nil
+            }
+        }
+    }
+
+    if lastErr == nil {
+        lastErr = fmt.Errorf("no broker reports produce api version")
+    }
+
+    return sarama.MinVersion, lastErr
+}
+
+// lowest kafka version supporting the produce api version
+func kafkaVersionByProduce(v int16) sarama.KafkaVersion {
+    produceVersions := []sarama.KafkaVersion{
+        2: sarama.V0_10_0_0,
+        3: sarama.V0_11_0_0,
+        4: sarama.V1_0_0_0,
+        5: sarama.V1_1_0_0,
+        6: sarama.V2_0_0_0,
+        7: sarama.V2_1_0_0,
+        8: sarama.V2_4_0_0,
+    }
+
+    if v < 2 {
+        return sarama.V0_10_0_0
+    }
+
+    if int(v) >= len(produceVersions) {
+        return produceVersions[len(produceVersions)-1]
     }
 
-    return sarama.MaxVersion
+    return produceVersions[v]
 }
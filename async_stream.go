@@ -0,0 +1,290 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  async_stream.go
+ * @version: 1.0.0
+ * @Date: 2026/10/19 下午4:40
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "encoding/binary"
+    "fmt"
+    "net"
+    "sync"
+    "time"
+)
+
+// stream config
+type StreamConfig struct {
+    Network     string        // 网络类型 tcp/unix，默认tcp
+    Address     string        // 服务地址，如 127.0.0.1:24224、/var/run/vector.sock
+    Framing     int           // 分帧方式 0-换行，1-4字节大端长度前缀
+    BufferLimit int           // 断线期间最多缓存的字节数，超过后丢弃最旧的日志，默认8MB
+    MaxBackoff  time.Duration // 重连最大退避时间，默认30s
+}
+
+type asyncStream struct {
+    network      string
+    address      string
+    framing      int
+    bufferLimit  int
+    maxBackoff   time.Duration
+    backoff      time.Duration
+    conn         net.Conn
+    pending      [][]byte          // framed records waiting to be written
+    pendingBytes int
+    written      int               // bytes of the head frame written on the current connection
+    bufs         net.Buffers       // pending frames of one writev, consumed by WriteTo
+    flushes      []*streamFlush    // Flush markers waiting for frames before them to be written
+    retry        <-chan time.Time
+    logQueue     chan logRecord
+    queueQuit    chan bool
+    errHandler   ErrorHandler
+}
+
+// Flush marker waiting for frames queued before it
+type streamFlush struct {
+    remaining int // frames before the marker not written or dropped yet
+    wg        *sync.WaitGroup
+}
+
+const (
+    STREAM_FRAMING_NEWLINE int = 0 // record + '\n'
+    STREAM_FRAMING_LENGTH  int = 1 // 4 bytes big endian length + record
+
+    streamMinBackoff   = 100 * time.Millisecond
+    streamWriteTimeout = 5 * time.Second
+)
+
+// new stream
+func newAsyncStream(s StreamConfig, q chan logRecord, eh ErrorHandler) *asyncStream {
+    c := new(asyncStream)
+    c.network = s.Network
+    c.address = s.Address
+    c.framing = s.Framing
+    c.bufferLimit = s.BufferLimit
+    c.maxBackoff = s.MaxBackoff
+    c.backoff = streamMinBackoff
+    c.logQueue = q
+    c.queueQuit = make(chan bool)
+    c.errHandler = eh
+
+    c.check()
+
+    c.reconnect()
+
+    go c.flushStream()
+
+    return c
+}
+
+// check param
+func (c *asyncStream) check() {
+    if c.network == "" {
+        c.network = "tcp"
+    }
+
+    if c.address == "" {
+        panic("stream address is empty")
+    }
+
+    if c.bufferLimit <= 0 {
+        c.bufferLimit = 8 * 1024 * 1024
+    }
+
+    if c.maxBackoff <= 0 {
+        c.maxBackoff = 30 * time.Second
+    }
+}
+
+// flush stream
+func (c *asyncStream) flushStream() {
+    for {
+        select {
+        case r := <-c.logQueue:
+            c.push(r)
+            if c.conn != nil {
+                c.writePending()
+            }
+            c.doneFlushes(false)
+
+        case <-c.retry:
+            c.reconnect()
+            c.doneFlushes(false)
+
+        case <-c.queueQuit:
+            for len(c.logQueue) > 0 {
+                c.push(<-c.logQueue)
+            }
+
+            if c.conn == nil {
+                c.reconnect()
+            }
+
+            if c.conn != nil {
+                c.writePending()
+                c.conn.Close()
+            }
+
+            if len(c.pending) > 0 {
+                c.errHandler(Event{
+                    Name: EVENT_STREAM_SEND,
+                    Msg:  fmt.Sprintf("log stream is exit, drop %d records", len(c.pending)),
+                    Err:  fmt.Errorf("%s %s not connected", c.network, c.address),
+                })
+            }
+
+            c.doneFlushes(true)
+            c.errHandler(Event{Name: EVENT_QUIT, Msg: "log stream is exit"})
+            c.queueQuit <- true
+            return
+        }
+    }
+}
+
+// frame record and append to pending, drop the oldest records when over buffer limit
+func (c *asyncStream) push(r logRecord) {
+    if r.marker {
+        if len(c.pending) == 0 {
+            r.flush.Done()
+        } else {
+            c.flushes = append(c.flushes, &streamFlush{remaining: len(c.pending), wg: r.flush})
+        }
+        return
+    }
+
+    var frame []byte
+
+    if c.framing == STREAM_FRAMING_LENGTH {
+        frame = make([]byte, 4, 4+len(r.data))
+        binary.BigEndian.PutUint32(frame, uint32(len(r.data)))
+        frame = append(frame, r.data...)
+    } else {
+        frame = make([]byte, 0, len(r.data)+1)
+        frame = append(frame, r.data...)
+        frame = append(frame, '\n')
+    }
+
+    r.release()
+
+    c.pending = append(c.pending, frame)
+    c.pendingBytes += len(frame)
+
+    // a partly written head frame is kept, the receiver is waiting for its tail
+    first := 0
+    if c.written > 0 {
+        first = 1
+    }
+
+    dropped := 0
+    for c.pendingBytes > c.bufferLimit && len(c.pending) > first+1 {
+        c.pendingBytes -= len(c.pending[first])
+        c.frameDone(first)
+        if first == 0 {
+            c.pending = c.pending[1:]
+        } else {
+            c.pending = append(c.pending[:1], c.pending[2:]...)
+        }
+        dropped++
+    }
+
+    if dropped > 0 {
+        c.errHandler(Event{
+            Name: EVENT_STREAM_SEND,
+            Msg:  fmt.Sprintf("buffer over %d bytes, drop %d records", c.bufferLimit, dropped),
+            Err:  fmt.Errorf("%s %s not connected", c.network, c.address),
+        })
+    }
+}
+
+// frame at position pos of the frames waiting before markers is written or dropped
+func (c *asyncStream) frameDone(pos int) {
+    for _, f := range c.flushes {
+        if pos < f.remaining {
+            f.remaining--
+        }
+    }
+}
+
+// done Flush markers whose frames are all written or dropped, every marker at quit
+func (c *asyncStream) doneFlushes(quit bool) {
+    flushes := c.flushes[:0]
+    for _, f := range c.flushes {
+        if f.remaining == 0 || quit {
+            f.wg.Done()
+        } else {
+            flushes = append(flushes, f)
+        }
+    }
+    c.flushes = flushes
+}
+
+// write pending records in one writev, reconnect with backoff when failed
+// frames stay whole in pending, a partly written head frame is resent from its start on a new connection
+func (c *asyncStream) writePending() {
+    if len(c.pending) == 0 {
+        return
+    }
+
+    // WriteTo consumes its own copy of the frame list
+    c.bufs = append(c.bufs[:0], c.pending...)
+    c.bufs[0] = c.bufs[0][c.written:]
+    bufs := c.bufs
+
+    c.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+    n, err := bufs.WriteTo(c.conn)
+
+    n += int64(c.written)
+    sent := 0
+    for sent < len(c.pending) && n >= int64(len(c.pending[sent])) {
+        n -= int64(len(c.pending[sent]))
+        c.pendingBytes -= len(c.pending[sent])
+        c.pending[sent] = nil
+        c.frameDone(0)
+        sent++
+    }
+    c.pending = c.pending[sent:]
+    c.written = int(n)
+
+    for i := range c.bufs {
+        c.bufs[i] = nil
+    }
+
+    if err != nil {
+        c.errHandler(Event{Name: EVENT_STREAM_SEND, Msg: "write " + c.network + " " + c.address, Err: err})
+        c.conn.Close()
+        c.conn = nil
+        c.retry = time.After(c.backoff)
+    }
+}
+
+// reconnect and write pending records
+func (c *asyncStream) reconnect() {
+    conn, err := net.DialTimeout(c.network, c.address, streamWriteTimeout)
+    if err != nil {
+        c.errHandler(Event{Name: EVENT_STREAM_SEND, Msg: "dial " + c.network + " " + c.address, Err: err})
+        c.retry = time.After(c.backoff)
+
+        c.backoff *= 2
+        if c.backoff > c.maxBackoff {
+            c.backoff = c.maxBackoff
+        }
+
+        return
+    }
+
+    c.conn = conn
+    c.retry = nil
+    c.backoff = streamMinBackoff
+    c.written = 0
+
+    c.writePending()
+}
+
+// quite
+func (c *asyncStream) SignQuite() bool {
+    c.queueQuit <- true
+    return <-c.queueQuit
+}
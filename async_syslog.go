@@ -0,0 +1,269 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  async_syslog.go
+ * @version: 1.0.0
+ * @Date: 2026/10/19 上午10:12
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "fmt"
+    "net"
+    "os"
+    "path/filepath"
+    "strconv"
+    "time"
+)
+
+// syslog config
+type SyslogConfig struct {
+    Network        string // 网络类型 udp/tcp/unix/unixgram，默认udp
+    Address        string // 服务地址，如 127.0.0.1:514、/dev/log
+    Format         int    // 消息格式 0-RFC5424，1-RFC3164
+    Facility       int    // syslog facility，默认 SYSLOG_FACILITY_USER
+    AppName        string // 应用名，默认进程名
+    Hostname       string // 主机名，默认 os.Hostname()
+    StructuredData string // RFC5424 structured-data，如 [meta@32473 env="prod"]，默认 -
+}
+
+type asyncSyslog struct {
+    network        string
+    address        string
+    format         int
+    facility       int
+    appName        string
+    hostname       string
+    structuredData string
+    pid            int
+    conn           net.Conn
+    logQueue       chan logRecord
+    queueQuit      chan bool
+    errHandler     ErrorHandler
+}
+
+const (
+    SYSLOG_FORMAT_RFC5424 int = 0 // <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+    SYSLOG_FORMAT_RFC3164 int = 1 // <PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+
+    SYSLOG_FACILITY_USER   int = 1
+    SYSLOG_FACILITY_DAEMON int = 3
+    SYSLOG_FACILITY_LOCAL0 int = 16
+    SYSLOG_FACILITY_LOCAL1 int = 17
+    SYSLOG_FACILITY_LOCAL2 int = 18
+    SYSLOG_FACILITY_LOCAL3 int = 19
+    SYSLOG_FACILITY_LOCAL4 int = 20
+    SYSLOG_FACILITY_LOCAL5 int = 21
+    SYSLOG_FACILITY_LOCAL6 int = 22
+    SYSLOG_FACILITY_LOCAL7 int = 23
+
+    syslogRetryTimes = 3
+)
+
+// new syslog
+func newAsyncSyslog(s SyslogConfig, q chan logRecord, eh ErrorHandler) *asyncSyslog {
+    c := new(asyncSyslog)
+    c.network = s.Network
+    c.address = s.Address
+    c.format = s.Format
+    c.facility = s.Facility
+    c.appName = s.AppName
+    c.hostname = s.Hostname
+    c.structuredData = s.StructuredData
+    c.pid = os.Getpid()
+    c.logQueue = q
+    c.queueQuit = make(chan bool)
+    c.errHandler = eh
+
+    c.check()
+
+    if err := c.dial(); err != nil {
+        c.errHandler(Event{Name: EVENT_SYSLOG_SEND, Msg: "dial " + c.network + " " + c.address, Err: err})
+    }
+
+    go c.flushSyslog()
+
+    return c
+}
+
+// check param
+func (c *asyncSyslog) check() {
+    if c.network == "" {
+        c.network = "udp"
+    }
+
+    if c.address == "" {
+        panic("syslog address is empty")
+    }
+
+    if c.facility <= 0 || c.facility > SYSLOG_FACILITY_LOCAL7 {
+        c.facility = SYSLOG_FACILITY_USER
+    }
+
+    if c.appName == "" {
+        c.appName = filepath.Base(os.Args[0])
+    }
+
+    if c.hostname == "" {
+        c.hostname, _ = os.Hostname()
+        if c.hostname == "" {
+            c.hostname = "-"
+        }
+    }
+
+    if c.structuredData == "" {
+        c.structuredData = "-"
+    }
+}
+
+// dial syslog server
+func (c *asyncSyslog) dial() error {
+    conn, err := net.DialTimeout(c.network, c.address, 5*time.Second)
+    if err != nil {
+        return err
+    }
+
+    c.conn = conn
+
+    return nil
+}
+
+// close connection
+func (c *asyncSyslog) close() {
+    if c.conn != nil {
+        c.conn.Close()
+        c.conn = nil
+    }
+}
+
+// flush syslog
+func (c *asyncSyslog) flushSyslog() {
+    for {
+        select {
+        case r := <-c.logQueue:
+            c.send(r)
+
+        case <-c.queueQuit:
+            for len(c.logQueue) > 0 {
+                c.send(<-c.logQueue)
+            }
+
+            c.close()
+            c.errHandler(Event{Name: EVENT_QUIT, Msg: "log syslog is exit"})
+            c.queueQuit <- true
+            return
+        }
+    }
+}
+
+// send record, reconnect and retry when failed
+func (c *asyncSyslog) send(r logRecord) {
+    // records before the marker are already sent
+    if r.marker {
+        r.flush.Done()
+        return
+    }
+
+    var (
+        err     error
+        msg     = c.encode(r)
+        backoff = 100 * time.Millisecond
+    )
+
+    r.release()
+
+    for i := 0; i < syslogRetryTimes; i++ {
+        if c.conn == nil {
+            if err = c.dial(); err != nil {
+                c.errHandler(Event{Name: EVENT_SYSLOG_SEND, Msg: "reconnect " + c.network + " " + c.address, Err: err})
+                time.Sleep(backoff)
+                backoff *= 2
+                continue
+            }
+        }
+
+        if _, err = c.conn.Write(msg); err == nil {
+            return
+        }
+
+        c.errHandler(Event{Name: EVENT_SYSLOG_SEND, Msg: "write " + c.network + " " + c.address, Err: err})
+        c.close()
+    }
+
+    c.errHandler(Event{Name: EVENT_SYSLOG_SEND, Msg: "drop message of " + strconv.Itoa(len(msg)) + " bytes", Err: err})
+}
+
+// encode record to syslog message, stream sockets use octet counting (RFC5424) or newline (RFC3164) framing
+func (c *asyncSyslog) encode(r logRecord) []byte {
+    var msg []byte
+
+    pri := c.facility*8 + syslogSeverity(r.level)
+
+    switch c.format {
+    case SYSLOG_FORMAT_RFC3164:
+        msg = append(msg, '<')
+        msg = strconv.AppendInt(msg, int64(pri), 10)
+        msg = append(msg, '>')
+        msg = r.time.AppendFormat(msg, time.Stamp)
+        msg = append(msg, ' ')
+        msg = append(msg, c.hostname...)
+        msg = append(msg, ' ')
+        msg = append(msg, c.appName...)
+        msg = append(msg, '[')
+        msg = strconv.AppendInt(msg, int64(c.pid), 10)
+        msg = append(msg, "]: "...)
+        msg = append(msg, r.data...)
+
+    default:
+        msg = append(msg, '<')
+        msg = strconv.AppendInt(msg, int64(pri), 10)
+        msg = append(msg, ">1 "...)
+        msg = r.time.AppendFormat(msg, time.RFC3339Nano)
+        msg = append(msg, ' ')
+        msg = append(msg, c.hostname...)
+        msg = append(msg, ' ')
+        msg = append(msg, c.appName...)
+        msg = append(msg, ' ')
+        msg = strconv.AppendInt(msg, int64(c.pid), 10)
+        msg = append(msg, " - "...)
+        msg = append(msg, c.structuredData...)
+        msg = append(msg, ' ')
+        msg = append(msg, r.data...)
+    }
+
+    switch c.network {
+    case "tcp", "tcp4", "tcp6", "unix":
+        if c.format == SYSLOG_FORMAT_RFC3164 {
+            return append(msg, '\n')
+        }
+
+        return append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+    }
+
+    return msg
+}
+
+// quite
+func (c *asyncSyslog) SignQuite() bool {
+    c.queueQuit <- true
+    return <-c.queueQuit
+}
+
+// syslog severity of log level, custom levels use the nearest builtin level below them
+func syslogSeverity(level Level) int {
+    switch {
+    case level >= LEVEL_PANIC:
+        return 1 // alert
+    case level >= LEVEL_FATAL:
+        return 2 // crit
+    case level >= LEVEL_ERROR:
+        return 3 // err
+    case level >= LEVEL_WARN:
+        return 4 // warning
+    case level >= LEVEL_INFO:
+        return 6 // info
+    default:
+        return 7 // debug
+    }
+}
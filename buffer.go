@@ -0,0 +1,153 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  buffer.go
+ * @version: 1.0.0
+ * @Date: 2026/10/22 上午10:30
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// pooled log buffer, shared by all outputs of a record and reused when the last one releases it
+type logBuffer struct {
+    b    []byte
+    refs int32
+    arr  [512]byte // initial storage of b, a pool miss costs only one allocation
+}
+
+const maxPooledBuffer = 64 * 1024 // larger buffers are left to gc
+
+var bufferPool = sync.Pool{
+    New: func() interface{} {
+        buf := new(logBuffer)
+        buf.b = buf.arr[:0]
+        return buf
+    },
+}
+
+// get buffer from pool
+func getBuffer() *logBuffer {
+    buf := bufferPool.Get().(*logBuffer)
+    buf.b = buf.b[:0]
+
+    return buf
+}
+
+// io.Writer for fmt.Fprint
+func (buf *logBuffer) Write(p []byte) (int, error) {
+    buf.b = append(buf.b, p...)
+    return len(p), nil
+}
+
+// release one reference, put back to pool by the last one
+func (buf *logBuffer) release() {
+    if atomic.AddInt32(&buf.refs, -1) == 0 && cap(buf.b) <= maxPooledBuffer {
+        bufferPool.Put(buf)
+    }
+}
+
+// release record buffer, outputs must not touch data after that
+func (r logRecord) release() {
+    if r.buf != nil {
+        r.buf.release()
+    }
+}
+
+// copy data and release buffer, for outputs holding records for a long time
+func (r logRecord) detach() logRecord {
+    if r.buf != nil {
+        r.data = append([]byte(nil), r.data...)
+        r.buf.release()
+        r.buf = nil
+    }
+
+    return r
+}
+
+// data with trailing newline, pooled buffers always keep a '\n' right after data
+func (r logRecord) line() []byte {
+    if r.buf != nil {
+        return r.data[:len(r.data)+1]
+    }
+
+    line := make([]byte, 0, len(r.data)+1)
+    line = append(line, r.data...)
+
+    return append(line, '\n')
+}
+
+// append zero padded int
+func appendInt(b []byte, v int, width int) []byte {
+    var tmp [20]byte
+
+    i := len(tmp)
+    for v >= 10 || width > 1 {
+        i--
+        tmp[i] = byte('0' + v%10)
+        v /= 10
+        width--
+    }
+    i--
+    tmp[i] = byte('0' + v)
+
+    return append(b, tmp[i:]...)
+}
+
+// append time as time.Time.String() without monotonic clock: 2006-01-02 15:04:05.999999999 -0700 MST
+func appendTime(b []byte, t time.Time) []byte {
+    year, month, day := t.Date()
+    hour, min, sec := t.Clock()
+
+    b = appendInt(b, year, 4)
+    b = append(b, '-')
+    b = appendInt(b, int(month), 2)
+    b = append(b, '-')
+    b = appendInt(b, day, 2)
+    b = append(b, ' ')
+    b = appendInt(b, hour, 2)
+    b = append(b, ':')
+    b = appendInt(b, min, 2)
+    b = append(b, ':')
+    b = appendInt(b, sec, 2)
+
+    if ns := t.Nanosecond(); ns != 0 {
+        digits := 9
+        for ns%10 == 0 {
+            ns /= 10
+            digits--
+        }
+        b = append(b, '.')
+        b = appendInt(b, ns, digits)
+    }
+
+    name, offset := t.Zone()
+    b = append(b, ' ')
+    b = appendZone(b, offset)
+
+    b = append(b, ' ')
+    if name == "" {
+        return appendZone(b, offset)
+    }
+
+    return append(b, name...)
+}
+
+// append zone offset as -0700
+func appendZone(b []byte, offset int) []byte {
+    if offset < 0 {
+        b = append(b, '-')
+        offset = -offset
+    } else {
+        b = append(b, '+')
+    }
+
+    b = appendInt(b, offset/3600, 2)
+
+    return appendInt(b, offset%3600/60, 2)
+}
@@ -0,0 +1,72 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  caller.go
+ * @version: 1.0.0
+ * @Date: 2026/10/22 下午4:15
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "runtime"
+    "sync/atomic"
+)
+
+// caller of log call
+type logCaller struct {
+    pc       uintptr
+    file     string
+    line     int
+    function string
+    stack    []uintptr // call stack from the call site, at or above StackLevel or ErrorStack
+    dropped  uint64    // records of the call site dropped by sampling before this one
+}
+
+// lock free pc cache, a slot keeps the latest entry hashed to it
+// loads never allocate, unlike sync.Map which boxes the uintptr key
+type pcSlots [1024]atomic.Value
+
+// frames of call sites, shared by all loggers
+var callerCache pcSlots
+
+// slot of pc
+func (s *pcSlots) slot(pc uintptr) *atomic.Value {
+    return &s[(pc^pc>>10)%uintptr(len(s))]
+}
+
+// caller, skip is counted from the function calling caller
+// lock free, frames are resolved once per pc and cached
+func (c *Logger) caller(skip int) logCaller {
+    var pcs [1]uintptr
+
+    // +2 skips runtime.Callers and caller itself
+    if runtime.Callers(skip+2, pcs[:]) == 0 {
+        return logCaller{file: "???"}
+    }
+
+    slot := callerCache.slot(pcs[0])
+    if cl, ok := slot.Load().(*logCaller); ok && cl.pc == pcs[0] {
+        return *cl
+    }
+
+    // a new slice keeps pcs on the stack for cache hits
+    frame, _ := runtime.CallersFrames([]uintptr{pcs[0]}).Next()
+    cl := &logCaller{pc: pcs[0], file: frame.File, line: frame.Line, function: frame.Function}
+    if cl.file == "" {
+        cl.file = "???"
+    }
+    slot.Store(cl)
+
+    return *cl
+}
+
+// call stack from the same frame as caller(skip)
+func (c *Logger) callers(skip int) []uintptr {
+    var pcs [64]uintptr
+
+    // +2 skips runtime.Callers and callers itself
+    n := runtime.Callers(skip+2, pcs[:])
+
+    return append([]uintptr(nil), pcs[:n]...)
+}
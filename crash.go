@@ -0,0 +1,85 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  crash.go
+ * @version: 1.0.0
+ * @Date: 2026/10/24 上午10:15
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "os/signal"
+    "sync"
+    "syscall"
+)
+
+// log recovered panic with stack at PANIC level, flush outputs within FlushTimeout and panic again
+// must be deferred directly: defer log.RecoverAndFlush()
+func (c *Logger) RecoverAndFlush() {
+    v := recover()
+    if v == nil {
+        return
+    }
+
+    // skip runtime.gopanic, the caller is the function that panicked
+    if ok, cl := c.enabledStack(LEVEL_PANIC, c.callDepth+1); ok {
+        c.write(LEVEL_PANIC, cl, fmt.Sprintf("panic: %v", v))
+    }
+
+    c.flushTimeout()
+
+    panic(v)
+}
+
+// flush outputs on SIGTERM and SIGINT (or sigs) within FlushTimeout, then raise the signal again
+// returns stop to restore the default behavior
+func (c *Logger) HandleSignals(sigs ...os.Signal) (stop func()) {
+    if len(sigs) == 0 {
+        sigs = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+    }
+
+    ch := make(chan os.Signal, 1)
+    done := make(chan bool)
+    signal.Notify(ch, sigs...)
+
+    go func() {
+        select {
+        case sig := <-ch:
+            // skip 1 is this goroutine, the caller of enabled
+            if ok, cl := c.enabled(LEVEL_WARN, 1); ok {
+                c.write(LEVEL_WARN, cl, "receive signal "+sig.String()+", flush logs")
+            }
+
+            c.flushTimeout()
+
+            // default action of the signal, usually exit
+            signal.Reset(sigs...)
+            if p, err := os.FindProcess(os.Getpid()); err == nil {
+                p.Signal(sig)
+            }
+
+        case <-done:
+            signal.Stop(ch)
+        }
+    }()
+
+    var once sync.Once
+
+    return func() {
+        once.Do(func() { close(done) })
+    }
+}
+
+// flush outputs within FlushTimeout, errors are reported to ErrorHandler
+func (c *Logger) flushTimeout() {
+    ctx, cancel := context.WithTimeout(context.Background(), c.flushWait)
+    defer cancel()
+
+    if err := c.Flush(ctx); err != nil {
+        c.errHandler(Event{Name: EVENT_FLUSH, Msg: "flush before exit", Err: err})
+    }
+}
@@ -0,0 +1,200 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  dedup.go
+ * @version: 1.0.0
+ * @Date: 2026/10/27 上午10:30
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "bytes"
+    "strconv"
+    "sync"
+    "time"
+)
+
+/**
+ * 重复日志合并，类似syslog的 "last message repeated N times"
+ * 同一调用位置连续输出相同级别、相同内容（消息和字段）的日志时，窗口内只输出第一条
+ * 该调用位置出现不同的日志、窗口结束、Flush或退出时输出一条汇总：last message repeated N times repeated=N
+ * 状态按调用位置分片，不同调用位置的日志不会竞争同一把锁
+ */
+
+type dedup struct {
+    window time.Duration
+    shards [64]dedupShard
+    emit   func(repeatSummary)
+}
+
+type dedupShard struct {
+    sync.Mutex
+    sites map[uintptr]*dedupSite
+}
+
+// last record of a call site
+type dedupSite struct {
+    caller   logCaller // without stack
+    level    Level
+    body     []byte    // message and fields, nil when no window is open
+    start    time.Time // time of the last emitted record
+    repeated int       // dropped since the last emitted record
+    timer    *time.Timer
+    seq      uint64    // window sequence, stale timers do nothing
+}
+
+// summary of repeated records
+type repeatSummary struct {
+    caller   logCaller
+    level    Level
+    repeated int
+}
+
+// new dedup, nil when window is 0
+func newDedup(window time.Duration, emit func(repeatSummary)) *dedup {
+    if window <= 0 {
+        return nil
+    }
+
+    d := &dedup{window: window, emit: emit}
+    for i := range d.shards {
+        d.shards[i].sites = make(map[uintptr]*dedupSite)
+    }
+
+    return d
+}
+
+// check record, body is its message and fields
+// returns whether it is a repeat and the summary of the previous repeats to write before it
+func (d *dedup) check(level Level, cl logCaller, body []byte, now time.Time) (bool, repeatSummary) {
+    shard := &d.shards[(cl.pc^cl.pc>>10)%uintptr(len(d.shards))]
+
+    shard.Lock()
+    defer shard.Unlock()
+
+    site := shard.sites[cl.pc]
+    if site == nil {
+        site = new(dedupSite)
+        shard.sites[cl.pc] = site
+    }
+
+    if site.body != nil && level == site.level && now.Sub(site.start) < d.window && bytes.Equal(body, site.body) {
+        site.repeated++
+        if site.timer == nil {
+            seq := site.seq
+            site.timer = time.AfterFunc(site.start.Add(d.window).Sub(now), func() { d.expire(shard, site, seq) })
+        }
+
+        return true, repeatSummary{}
+    }
+
+    s := site.take()
+
+    cl.stack = nil
+    site.caller, site.level, site.start = cl, level, now
+    site.body = append(site.body[:0], body...)
+
+    return false, s
+}
+
+// take summary and stop the window timer, locked
+func (s *dedupSite) take() repeatSummary {
+    rs := repeatSummary{caller: s.caller, level: s.level, repeated: s.repeated}
+    s.repeated = 0
+    s.seq++
+
+    if s.timer != nil {
+        s.timer.Stop()
+        s.timer = nil
+    }
+
+    return rs
+}
+
+// window end, the next identical record of the call site starts a new window
+func (d *dedup) expire(shard *dedupShard, site *dedupSite, seq uint64) {
+    shard.Lock()
+    if seq != site.seq {
+        shard.Unlock()
+        return
+    }
+    s := site.take()
+    site.body = nil
+    shard.Unlock()
+
+    d.emit(s)
+}
+
+// take summaries of pending repeats of every call site, before Flush and quit
+func (d *dedup) flush() []repeatSummary {
+    var summaries []repeatSummary
+
+    for i := range d.shards {
+        shard := &d.shards[i]
+
+        shard.Lock()
+        for _, site := range shard.sites {
+            if site.repeated > 0 {
+                summaries = append(summaries, site.take())
+            }
+        }
+        shard.Unlock()
+    }
+
+    return summaries
+}
+
+// message of summary
+func (s repeatSummary) message() string {
+    return "last message repeated " + strconv.Itoa(s.repeated) + " times"
+}
+
+// write record of a log call, repeats are dropped when Dedup is set
+func (c *Logger) writeDedup(r logRecord, msgStart int, cl logCaller) error {
+    if c.dedup == nil {
+        return c.writeRecord(r)
+    }
+
+    repeat, s := c.dedup.check(r.level, cl, r.buf.b[msgStart:], r.time)
+    if repeat {
+        r.buf.refs = 1
+        r.release()
+        return nil
+    }
+
+    err := c.writeSummary(s)
+    if e := c.writeRecord(r); e != nil {
+        err = e
+    }
+
+    return err
+}
+
+// write summary from the caller of the repeated records
+func (c *Logger) writeSummary(s repeatSummary) error {
+    if s.repeated == 0 {
+        return nil
+    }
+
+    r := c.newRecord(s.level, s.caller)
+    msgStart := len(r.buf.b)
+    r.buf.b = append(r.buf.b, s.message()...)
+    r = c.markMessage(r, msgStart)
+    c.endMessage(r, msgStart, s.caller)
+    r.buf.b = c.appendField(r.buf.b, "repeated", s.repeated)
+    c.endFields(r, s.caller)
+
+    return c.writeRecord(r)
+}
+
+// write summary of pending repeats
+func (c *Logger) flushRepeated() {
+    if c.dedup == nil {
+        return
+    }
+
+    for _, s := range c.dedup.flush() {
+        c.writeSummary(s)
+    }
+}
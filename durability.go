@@ -0,0 +1,100 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  durability.go
+ * @version: 1.0.0
+ * @Date: 2026/10/23 下午3:10
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "os"
+    "strconv"
+    "time"
+)
+
+const (
+    DURABILITY_SYNC  int = 0 // open file with O_SYNC, every write reaches disk
+    DURABILITY_FSYNC int = 1 // fsync every FsyncInterval or FsyncBytes
+    DURABILITY_OS    int = 2 // leave it to the os page cache
+)
+
+// fsync by interval and written bytes, only used by DURABILITY_FSYNC
+type fileSyncer struct {
+    mode     int
+    interval time.Duration
+    bytes    int
+    unsynced int
+    last     time.Time
+}
+
+// new file syncer
+func newFileSyncer(s LogConfig) fileSyncer {
+    switch s.Durability {
+    case DURABILITY_SYNC, DURABILITY_FSYNC, DURABILITY_OS:
+
+    default:
+        panic("unknown durability: " + strconv.Itoa(s.Durability))
+    }
+
+    fs := fileSyncer{mode: s.Durability, interval: s.FsyncInterval, bytes: s.FsyncBytes, last: time.Now()}
+    if fs.interval <= 0 {
+        fs.interval = time.Second
+    }
+
+    return fs
+}
+
+// open log file
+func (fs *fileSyncer) open(fileFullPath string) (*os.File, error) {
+    flag := os.O_RDWR | os.O_CREATE | os.O_APPEND
+    if fs.mode == DURABILITY_SYNC {
+        flag |= os.O_SYNC
+    }
+
+    return os.OpenFile(fileFullPath, flag, 0644)
+}
+
+// n bytes written, fsync when over FsyncBytes or FsyncInterval
+func (fs *fileSyncer) wrote(f *os.File, n int) error {
+    if fs.mode != DURABILITY_FSYNC {
+        return nil
+    }
+
+    fs.unsynced += n
+    if (fs.bytes > 0 && fs.unsynced >= fs.bytes) || time.Since(fs.last) >= fs.interval {
+        return fs.sync(f)
+    }
+
+    return nil
+}
+
+// fsync when FsyncInterval passed, for idle files
+func (fs *fileSyncer) tick(f *os.File) error {
+    if fs.mode != DURABILITY_FSYNC || time.Since(fs.last) < fs.interval {
+        return nil
+    }
+
+    return fs.sync(f)
+}
+
+// fsync whatever the durability, for Flush
+func (fs *fileSyncer) force(f *os.File) error {
+    fs.unsynced = 0
+    fs.last = time.Now()
+
+    return f.Sync()
+}
+
+// fsync written bytes
+func (fs *fileSyncer) sync(f *os.File) error {
+    if fs.mode != DURABILITY_FSYNC || fs.unsynced == 0 {
+        return nil
+    }
+
+    fs.unsynced = 0
+    fs.last = time.Now()
+
+    return f.Sync()
+}
@@ -0,0 +1,229 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  fields.go
+ * @version: 1.0.0
+ * @Date: 2026/10/25 上午10:40
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "reflect"
+    "strconv"
+    "time"
+)
+
+// error with key values, logged as fields by ErrorErr, e.g. the order id of a failed order
+type FieldsError interface {
+    error
+    Fields() []interface{} // key, value, key, value ...
+}
+
+const badKey = "!BADKEY" // key of a value without key
+
+// error with message, error type, unwrap chain and fields
+// text: msg order_id=12 error="..." error_type=*os.PathError error_chain=[syscall.Errno:"..."]
+// json: "msg":"msg","order_id":12,"error":"...","error_type":"*os.PathError","error_chain":[{"type":"syscall.Errno","error":"..."}]
+func (c *Logger) ErrorErr(err error, msg string, fields ...interface{}) {
+    if ok, cl := c.enabled(LEVEL_ERROR, c.callDepth); ok {
+        c.writeErr(LEVEL_ERROR, cl, err, msg, fields)
+    }
+}
+
+// ErrorErr at level
+func (c *Logger) LogErr(level Level, err error, msg string, fields ...interface{}) {
+    if ok, cl := c.enabled(level, c.callDepth); ok {
+        c.writeErr(level, cl, err, msg, fields)
+    }
+}
+
+// write message with error and fields
+func (c *Logger) writeErr(level Level, cl logCaller, err error, msg string, fields []interface{}) error {
+    r := c.newRecord(level, cl)
+    msgStart := len(r.buf.b)
+    r.buf.b = append(r.buf.b, msg...)
+    r = c.markMessage(r, msgStart)
+    c.endMessage(r, msgStart, cl)
+    r.buf.b = c.appendFields(r.buf.b, fields)
+    if err != nil {
+        r.buf.b = c.appendError(r.buf.b, err)
+    }
+    c.endFields(r, cl)
+
+    return c.writeDedup(r, msgStart, cl)
+}
+
+// append key values
+func (c *Logger) appendFields(b []byte, fields []interface{}) []byte {
+    for i := 0; i < len(fields); i += 2 {
+        if i+1 == len(fields) {
+            return c.appendField(b, badKey, fields[i])
+        }
+
+        key, ok := fields[i].(string)
+        if !ok {
+            key = fmt.Sprint(fields[i])
+        }
+        b = c.appendField(b, key, fields[i+1])
+    }
+
+    return b
+}
+
+// append error, its type, unwrap chain and fields of every error in the chain
+func (c *Logger) appendError(b []byte, err error) []byte {
+    b = c.appendField(b, "error", err.Error())
+    b = c.appendField(b, "error_type", reflect.TypeOf(err).String())
+
+    if cause := errors.Unwrap(err); cause != nil {
+        if c.format == LOG_FORMAT_JSON {
+            b = append(b, `,"error_chain":[`...)
+        } else {
+            b = append(b, " error_chain=["...)
+        }
+
+        for e := cause; e != nil; e = errors.Unwrap(e) {
+            if e != cause {
+                b = append(b, ',')
+            }
+
+            msg := e.Error()
+            if c.redactor != nil {
+                msg = c.redactor.text(msg)
+            }
+
+            if c.format == LOG_FORMAT_JSON {
+                b = append(b, `{"type":`...)
+                b = appendJSONString(b, reflect.TypeOf(e).String())
+                b = append(b, `,"error":`...)
+                b = appendJSONString(b, msg)
+                b = append(b, '}')
+            } else {
+                b = append(b, reflect.TypeOf(e).String()...)
+                b = append(b, ':')
+                b = strconv.AppendQuote(b, msg)
+            }
+        }
+
+        b = append(b, ']')
+    }
+
+    for e := err; e != nil; e = errors.Unwrap(e) {
+        if fe, ok := e.(FieldsError); ok {
+            b = c.appendFields(b, fe.Fields())
+        }
+    }
+
+    return b
+}
+
+// append key=value, or "key":value for json
+func (c *Logger) appendField(b []byte, key string, v interface{}) []byte {
+    if c.redactor != nil {
+        v = c.redactor.value(key, v)
+    }
+
+    if c.format == LOG_FORMAT_JSON {
+        b = append(b, ',')
+        b = appendJSONString(b, key)
+        b = append(b, ':')
+
+        return appendJSONValue(b, v)
+    }
+
+    b = append(b, ' ')
+    b = append(b, key...)
+    b = append(b, '=')
+
+    return appendTextValue(b, v)
+}
+
+// append value, quoted when empty or with spaces, quotes or '='
+func appendTextValue(b []byte, v interface{}) []byte {
+    var s string
+
+    switch v := v.(type) {
+    case string:
+        s = v
+    case int:
+        return strconv.AppendInt(b, int64(v), 10)
+    case int64:
+        return strconv.AppendInt(b, v, 10)
+    case uint64:
+        return strconv.AppendUint(b, v, 10)
+    case bool:
+        return strconv.AppendBool(b, v)
+    case error:
+        s = v.Error()
+    case fmt.Stringer:
+        s = v.String()
+    default:
+        s = fmt.Sprint(v)
+    }
+
+    for i := 0; i < len(s); i++ {
+        if s[i] <= ' ' || s[i] == '"' || s[i] == '=' {
+            return strconv.AppendQuote(b, s)
+        }
+    }
+
+    if s == "" {
+        return append(b, `""`...)
+    }
+
+    return append(b, s...)
+}
+
+// append float, NaN and infinities are not json numbers and are written as strings
+func appendJSONFloat(b []byte, f float64, bits int) []byte {
+    if math.IsNaN(f) || math.IsInf(f, 0) {
+        return appendJSONString(b, strconv.FormatFloat(f, 'g', -1, bits))
+    }
+
+    return strconv.AppendFloat(b, f, 'g', -1, bits)
+}
+
+// append json value, numbers and bools as they are, errors and Stringers as strings
+func appendJSONValue(b []byte, v interface{}) []byte {
+    switch v := v.(type) {
+    case nil:
+        return append(b, "null"...)
+    case string:
+        return appendJSONString(b, v)
+    case int:
+        return strconv.AppendInt(b, int64(v), 10)
+    case int32:
+        return strconv.AppendInt(b, int64(v), 10)
+    case int64:
+        return strconv.AppendInt(b, v, 10)
+    case uint:
+        return strconv.AppendUint(b, uint64(v), 10)
+    case uint32:
+        return strconv.AppendUint(b, uint64(v), 10)
+    case uint64:
+        return strconv.AppendUint(b, v, 10)
+    case float32:
+        return appendJSONFloat(b, float64(v), 32)
+    case float64:
+        return appendJSONFloat(b, v, 64)
+    case bool:
+        return strconv.AppendBool(b, v)
+    case time.Duration:
+        return appendJSONString(b, v.String())
+    case error:
+        return appendJSONString(b, v.Error())
+    case fmt.Stringer:
+        return appendJSONString(b, v.String())
+    }
+
+    if data, err := json.Marshal(v); err == nil {
+        return append(b, data...)
+    }
+
+    return appendJSONString(b, fmt.Sprint(v))
+}
@@ -0,0 +1,265 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  format.go
+ * @version: 1.0.0
+ * @Date: 2026/10/24 下午2:30
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "runtime"
+    "strconv"
+    "time"
+)
+
+const (
+    LOG_FORMAT_TEXT int = 0 // [INFO] file.go:12 message
+    LOG_FORMAT_JSON int = 1 // {"time":"...","level":"INFO","caller":"file.go:12","msg":"message"}
+
+    TIME_FORMAT_DEFAULT     string = ""            // 2006-01-02 15:04:05.999999999 -0700 MST
+    TIME_FORMAT_RFC3339     string = "rfc3339"     // 2006-01-02T15:04:05Z07:00
+    TIME_FORMAT_RFC3339NANO string = "rfc3339nano" // 2006-01-02T15:04:05.999999999Z07:00
+    TIME_FORMAT_UNIX        string = "unix"        // seconds since epoch
+    TIME_FORMAT_UNIX_MS     string = "unixms"      // milliseconds since epoch
+    TIME_FORMAT_UNIX_US     string = "unixus"      // microseconds since epoch
+
+    hexDigits = "0123456789abcdef"
+)
+
+// append log time by TimeFormat and TimeUTC, no allocation
+func (c *Logger) appendTimestamp(b []byte, t time.Time) []byte {
+    if c.timeUTC {
+        t = t.UTC()
+    } else {
+        t = t.Local()
+    }
+
+    switch c.timeFormat {
+    case TIME_FORMAT_DEFAULT:
+        return appendTime(b, t)
+    case TIME_FORMAT_RFC3339:
+        return t.AppendFormat(b, time.RFC3339)
+    case TIME_FORMAT_RFC3339NANO:
+        return t.AppendFormat(b, time.RFC3339Nano)
+    case TIME_FORMAT_UNIX:
+        return strconv.AppendInt(b, t.Unix(), 10)
+    case TIME_FORMAT_UNIX_MS:
+        return strconv.AppendInt(b, t.UnixNano()/int64(time.Millisecond), 10)
+    case TIME_FORMAT_UNIX_US:
+        return strconv.AppendInt(b, t.UnixNano()/int64(time.Microsecond), 10)
+    }
+
+    // custom go layout
+    return t.AppendFormat(b, c.timeFormat)
+}
+
+// epoch time formats are json numbers
+func (c *Logger) timeIsNumber() bool {
+    return c.timeFormat == TIME_FORMAT_UNIX || c.timeFormat == TIME_FORMAT_UNIX_MS || c.timeFormat == TIME_FORMAT_UNIX_US
+}
+
+// json record until "msg":", fields follow Flag
+func (c *Logger) appendJSONHeader(b []byte, t time.Time, lvl Level, cl logCaller) []byte {
+    b = append(b, '{')
+
+    if c.flag&L_Time != 0 {
+        if c.timeIsNumber() {
+            b = append(b, `"time":`...)
+            b = c.appendTimestamp(b, t)
+        } else {
+            b = append(b, `"time":"`...)
+            b = escapeJSONTail(c.appendTimestamp(b, t), len(b))
+            b = append(b, '"')
+        }
+        b = append(b, ',')
+    }
+
+    if c.flag&L_PID != 0 {
+        b = append(b, `"pid":`...)
+        b = strconv.AppendInt(b, int64(c.pid), 10)
+        b = append(b, ',')
+    }
+
+    if c.flag&L_LEVEL != 0 {
+        b = append(b, `"level":`...)
+        b = appendJSONString(b, lvl.String())
+        b = append(b, ',')
+    }
+
+    if c.flag&(L_LONG_FILE|L_SHORT_FILE) != 0 {
+        b = append(b, `"caller":"`...)
+        b = appendJSONEscaped(b, c.callerFile(cl))
+        b = append(b, ':')
+        b = strconv.AppendInt(b, int64(cl.line), 10)
+        b = append(b, `",`...)
+    }
+
+    return append(b, `"msg":"`...)
+}
+
+// redact the message and keep its offsets in text records, for outputs rendering their own header
+func (c *Logger) markMessage(r logRecord, msgStart int) logRecord {
+    c.redactMessage(r, msgStart)
+
+    if c.format == LOG_FORMAT_TEXT {
+        r.msg = int32(msgStart)
+        r.fields = int32(len(r.buf.b))
+    }
+
+    return r
+}
+
+// finish record after the message appended to r.buf from msgStart
+func (c *Logger) endRecord(r logRecord, msgStart int, cl logCaller) {
+    c.endMessage(r, msgStart, cl)
+    c.endFields(r, cl)
+}
+
+// json: escape message appended from msgStart and close it, text: template between {msg} and {fields}
+// fields may follow
+func (c *Logger) endMessage(r logRecord, msgStart int, cl logCaller) {
+    if c.format != LOG_FORMAT_JSON {
+        if c.template != nil {
+            r.buf.b = c.appendTemplate(r.buf.b, c.template.mid, r, cl)
+        }
+
+        return
+    }
+
+    r.buf.b = escapeJSONTail(r.buf.b, msgStart)
+    r.buf.b = append(r.buf.b, '"')
+}
+
+// append template after {fields} and stack, as an indented block for text and stack field for json
+func (c *Logger) endFields(r logRecord, cl logCaller) {
+    if cl.dropped > 0 {
+        r.buf.b = c.appendField(r.buf.b, "suppressed", cl.dropped)
+    }
+
+    if c.format != LOG_FORMAT_JSON {
+        if c.template != nil {
+            r.buf.b = c.appendTemplate(r.buf.b, c.template.tail, r, cl)
+        }
+
+        if cl.stack != nil {
+            r.buf.b = appendStack(r.buf.b, cl.stack, "\n\t", "\n\t\t")
+        }
+
+        return
+    }
+
+    if cl.stack != nil {
+        r.buf.b = append(r.buf.b, `,"stack":"`...)
+        r.buf.b = appendStack(r.buf.b, cl.stack, "", `\n\t`)
+        r.buf.b = append(r.buf.b, '"')
+    }
+
+    r.buf.b = append(r.buf.b, '}')
+}
+
+// append frames as function, file:line
+// text: \n\tfunc\n\t\tfile:line, json: func\n\tfile:line\n escaped like runtime/debug.Stack
+func appendStack(b []byte, pcs []uintptr, funcPrefix, filePrefix string) []byte {
+    frames := runtime.CallersFrames(pcs)
+    json := funcPrefix == ""
+
+    for {
+        frame, more := frames.Next()
+
+        b = append(b, funcPrefix...)
+        if json {
+            b = appendJSONEscaped(b, frame.Function)
+        } else {
+            b = append(b, frame.Function...)
+        }
+        b = append(b, filePrefix...)
+        if json {
+            b = appendJSONEscaped(b, frame.File)
+        } else {
+            b = append(b, frame.File...)
+        }
+        b = append(b, ':')
+        b = strconv.AppendInt(b, int64(frame.Line), 10)
+
+        if json && more {
+            b = append(b, `\n`...)
+        }
+
+        if !more {
+            return b
+        }
+    }
+}
+
+// append quoted json string
+func appendJSONString(b []byte, s string) []byte {
+    b = append(b, '"')
+    b = appendJSONEscaped(b, s)
+
+    return append(b, '"')
+}
+
+// append json escaped s without quotes
+func appendJSONEscaped(b []byte, s string) []byte {
+    start := 0
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if c >= 0x20 && c != '"' && c != '\\' {
+            continue
+        }
+
+        b = append(b, s[start:i]...)
+        b = appendJSONEscape(b, c)
+        start = i + 1
+    }
+
+    return append(b, s[start:]...)
+}
+
+// escape b[start:] in place, copy through a pooled buffer only when needed
+func escapeJSONTail(b []byte, start int) []byte {
+    i := start
+    for ; i < len(b); i++ {
+        if c := b[i]; c < 0x20 || c == '"' || c == '\\' {
+            break
+        }
+    }
+
+    if i == len(b) {
+        return b
+    }
+
+    tmp := getBuffer()
+    tmp.b = append(tmp.b, b[i:]...)
+    b = b[:i]
+    for _, c := range tmp.b {
+        if c >= 0x20 && c != '"' && c != '\\' {
+            b = append(b, c)
+        } else {
+            b = appendJSONEscape(b, c)
+        }
+    }
+
+    tmp.refs = 1
+    tmp.release()
+
+    return b
+}
+
+// append escape sequence of a json special byte
+func appendJSONEscape(b []byte, c byte) []byte {
+    switch c {
+    case '"', '\\':
+        return append(b, '\\', c)
+    case '\n':
+        return append(b, '\\', 'n')
+    case '\r':
+        return append(b, '\\', 'r')
+    case '\t':
+        return append(b, '\\', 't')
+    }
+
+    return append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+}
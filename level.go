@@ -0,0 +1,143 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  level.go
+ * @version: 1.0.0
+ * @Date: 2026/10/20 上午10:05
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+)
+
+// log level, a record is written when its level >= the configured level
+type Level int
+
+const (
+    LEVEL_DEBUG Level = 0
+    LEVEL_INFO  Level = 1
+    LEVEL_WARN  Level = 2
+    LEVEL_ERROR Level = 3
+    LEVEL_FATAL Level = 4
+    LEVEL_PANIC Level = 5
+)
+
+// names of builtin levels, read without locks on every record
+var builtinLevels = [...]string{
+    LEVEL_DEBUG: "DEBUG",
+    LEVEL_INFO:  "INFO",
+    LEVEL_WARN:  "WARN",
+    LEVEL_ERROR: "ERROR",
+    LEVEL_FATAL: "FATAL",
+    LEVEL_PANIC: "PANIC",
+}
+
+var (
+    levelMu      sync.Mutex   // serializes RegisterLevel
+    customLevels atomic.Value // map[Level]string, copied on register and never modified after Store
+)
+
+func init() {
+    customLevels.Store(map[Level]string{})
+}
+
+// name of level, registered custom levels included
+func levelName(l Level) (string, bool) {
+    if l >= 0 && int(l) < len(builtinLevels) {
+        return builtinLevels[l], true
+    }
+
+    n, ok := customLevels.Load().(map[Level]string)[l]
+
+    return n, ok
+}
+
+// register custom level, e.g. RegisterLevel(-1, "TRACE"), RegisterLevel(6, "AUDIT")
+func RegisterLevel(l Level, name string) error {
+    name = strings.ToUpper(strings.TrimSpace(name))
+    if name == "" {
+        return fmt.Errorf("level name is empty")
+    }
+
+    levelMu.Lock()
+    defer levelMu.Unlock()
+
+    if n, ok := levelName(l); ok {
+        return fmt.Errorf("level %d is registered as %s", int(l), n)
+    }
+
+    if k, ok := levelByName(name); ok {
+        return fmt.Errorf("level name %s is registered as %d", name, int(k))
+    }
+
+    old := customLevels.Load().(map[Level]string)
+    levels := make(map[Level]string, len(old)+1)
+    for k, n := range old {
+        levels[k] = n
+    }
+    levels[l] = name
+    customLevels.Store(levels)
+
+    return nil
+}
+
+// level of upper case name
+func levelByName(name string) (Level, bool) {
+    for k, n := range builtinLevels {
+        if n == name {
+            return Level(k), true
+        }
+    }
+
+    for k, n := range customLevels.Load().(map[Level]string) {
+        if n == name {
+            return k, true
+        }
+    }
+
+    return LEVEL_DEBUG, false
+}
+
+// parse level name (case insensitive) or number
+func ParseLevel(s string) (Level, error) {
+    name := strings.ToUpper(strings.TrimSpace(s))
+
+    if l, ok := levelByName(name); ok {
+        return l, nil
+    }
+
+    if i, err := strconv.Atoi(name); err == nil {
+        return Level(i), nil
+    }
+
+    return LEVEL_DEBUG, fmt.Errorf("unknown log level: %q", s)
+}
+
+func (l Level) String() string {
+    if n, ok := levelName(l); ok {
+        return n
+    }
+
+    return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+    return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(text []byte) error {
+    v, err := ParseLevel(string(text))
+    if err != nil {
+        return err
+    }
+
+    *l = v
+
+    return nil
+}
@@ -0,0 +1,136 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  level_http.go
+ * @version: 1.0.0
+ * @Date: 2026/10/20 下午3:20
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "sync/atomic"
+    "time"
+)
+
+var (
+    errLevelRequired    = errors.New("level is required")
+    errRevertInvalid    = errors.New("revert must be a positive duration, e.g. 10m")
+    errMethodNotAllowed = errors.New("method not allowed")
+)
+
+// level handler request and response body
+type levelBody struct {
+    Level  *Level `json:"level"`
+    Revert string `json:"revert,omitempty"` // auto revert duration, e.g. 10m
+}
+
+// current log level
+func (c *Logger) Level() Level {
+    return Level(atomic.LoadInt32(&c.logLevel))
+}
+
+// set log level at runtime, cancel pending auto revert
+func (c *Logger) SetLevel(l Level) {
+    c.revertMu.Lock()
+    defer c.revertMu.Unlock()
+
+    if c.revertTimer != nil {
+        c.revertTimer.Stop()
+        c.revertTimer = nil
+    }
+
+    atomic.StoreInt32(&c.logLevel, int32(l))
+}
+
+// set log level and revert to the current one after d
+func (c *Logger) SetLevelFor(l Level, d time.Duration) {
+    c.revertMu.Lock()
+    defer c.revertMu.Unlock()
+
+    if c.revertTimer != nil {
+        // keep reverting to the level before the first temporary change
+        c.revertTimer.Stop()
+    } else {
+        c.revertLevel = c.Level()
+    }
+
+    atomic.StoreInt32(&c.logLevel, int32(l))
+
+    var timer *time.Timer
+    timer = time.AfterFunc(d, func() {
+        c.revertMu.Lock()
+        defer c.revertMu.Unlock()
+
+        if c.revertTimer == timer {
+            atomic.StoreInt32(&c.logLevel, int32(c.revertLevel))
+            c.revertTimer = nil
+        }
+    })
+    c.revertTimer = timer
+}
+
+// http handler of log level
+// GET returns {"level":"INFO"}
+// PUT {"level":"debug","revert":"10m"} or ?level=debug&revert=10m changes it, revert is optional
+func (c *Logger) LevelHandler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var (
+            body   levelBody
+            revert time.Duration
+            err    error
+        )
+
+        switch r.Method {
+        case http.MethodGet:
+
+        case http.MethodPut:
+            if q := r.URL.Query(); q.Get("level") != "" {
+                var l Level
+                if err = l.UnmarshalText([]byte(q.Get("level"))); err != nil {
+                    writeLevelError(w, http.StatusBadRequest, err)
+                    return
+                }
+                body.Level = &l
+                body.Revert = q.Get("revert")
+            } else if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+                writeLevelError(w, http.StatusBadRequest, err)
+                return
+            }
+
+            if body.Level == nil {
+                writeLevelError(w, http.StatusBadRequest, errLevelRequired)
+                return
+            }
+
+            if body.Revert != "" {
+                if revert, err = time.ParseDuration(body.Revert); err != nil || revert <= 0 {
+                    writeLevelError(w, http.StatusBadRequest, errRevertInvalid)
+                    return
+                }
+                c.SetLevelFor(*body.Level, revert)
+            } else {
+                c.SetLevel(*body.Level)
+            }
+
+        default:
+            w.Header().Set("Allow", "GET, PUT")
+            writeLevelError(w, http.StatusMethodNotAllowed, errMethodNotAllowed)
+            return
+        }
+
+        l := c.Level()
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(levelBody{Level: &l, Revert: body.Revert})
+    })
+}
+
+// write handler error
+func writeLevelError(w http.ResponseWriter, code int, err error) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
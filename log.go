@@ -9,10 +9,10 @@
 package asynclog
 
 import (
-    "errors"
+    "context"
     "fmt"
     "os"
-    "runtime"
+    "strconv"
     "sync"
     "syscall"
     "time"
@@ -22,21 +22,45 @@ import (
  * 异步高效写日志
  * 通过极大的降低了磁盘的io
  *
- * logLevel: 0-Debug,1-Info,2-Warn,3-Error,4-Fatal,5-Panic
+ * logLevel: 0-Debug,1-Info,2-Warn,3-Error,4-Fatal,5-Panic, see Level
  * log: [time][level][file][log data]
  */
 
 // config
 type LogConfig struct {
-    Type         int    // 写日志方式 1-同步写文件，2-异步写文件
-    FileFullPath string // 日志文件全路径
-    QueueSize    int    // 队列大小
-    BufferSize   int    // buffer大小
-    SplitLogType int    // 切割日志方式 0-不切割，1-按天，2-按小时
-    Level        int    // 日志级别
-    CallDepth    int    // 写日志文件，回调runtime栈深度，默认是2
-    Flag         int
-    KafkaConfig  KafkaConfig
+    Type          int            // 写日志方式 1-同步写文件，2-异步写文件
+    Outputs       []int          // 多路输出，如 []int{WRITE_LOG_TYPE_FILE, WRITE_LOG_TYPE_KAFKA}，设置后忽略Type
+    FileFullPath  string         // 日志文件全路径
+    QueueSize     int            // 队列大小
+    QueueType     int            // 队列类型 0-channel，1-分片无锁队列（多核高并发写日志时使用）
+    QueueShards   int            // 分片无锁队列的分片数，默认GOMAXPROCS
+    BufferSize    int            // buffer大小
+    Durability    int            // 落盘方式 0-O_SYNC每次写入都落盘，1-按时间/大小fsync，2-交给操作系统
+    FsyncInterval time.Duration  // Durability为1时的fsync间隔，默认1s
+    FsyncBytes    int            // Durability为1时写入多少字节后fsync，默认0不按大小
+    FlushInterval time.Duration  // 异步写文件刷盘间隔，默认1s
+    FlushLevel    Level          // 大于等于该级别的日志在调用返回前写入文件，如 LEVEL_ERROR，默认0不开启
+    FlushTimeout  time.Duration  // RecoverAndFlush、HandleSignals退出前等待日志写入的最长时间，默认5s
+    Format        int            // 日志格式 0-文本，1-json
+    TimeFormat    string         // 时间格式 rfc3339、rfc3339nano、unix、unixms、unixus 或go layout，默认 2006-01-02 15:04:05.999999999 -0700 MST
+    TimeUTC       bool           // 使用UTC时间，默认本地时间
+    Template      string         // 文本日志模板，设置后忽略Flag，如 "{time} {level:5} {caller} | {msg} {fields}"
+    Name          string         // logger名称，模板中的 {name}
+    StackLevel    Level          // 大于等于该级别的日志自动记录调用堆栈，如 LEVEL_ERROR，默认0不开启
+    Sampling      SamplingConfig // 按调用位置采样、限流，默认不开启
+    Redact        RedactConfig   // 敏感信息脱敏（字段名黑名单、正则、内置检测），所有输出之前处理，默认不开启
+    Dedup         time.Duration  // 合并窗口内同一调用位置连续相同的日志，输出 "last message repeated N times"，默认0不开启
+    SplitLogType  int            // 切割日志方式 0-不切割，1-按天，2-按小时
+    Level         Level          // 日志级别，LEVEL_DEBUG ~ LEVEL_PANIC，配置文件中可写 "info"、"warn" 等
+    CallDepth     int            // 写日志文件，回调runtime栈深度，默认是2
+    VModule       string         // 按文件覆盖日志级别，如 "orders/*=debug,http=warn"，第一个匹配的规则生效
+    Flag          int
+    KafkaConfig   KafkaConfig
+    SyslogConfig  SyslogConfig
+    HttpConfig    HttpConfig
+    StreamConfig  StreamConfig
+    ConsoleConfig ConsoleConfig
+    ErrorHandler  ErrorHandler   // 内部事件回调（发送失败、刷盘失败、切割、重新打开文件等），默认错误输出到stderr
 }
 
 // kafka config
@@ -52,21 +76,59 @@ type KafkaConfig struct {
 // loggers
 type Logger struct {
     sync.Mutex
-    logType     int            // 写日志方式 1-同步写文件，2-异步写文件，3-异步写kafka
-    logLevel    int            // 日志级别
-    levelMap    map[int]string // 日志级别
-    splitLog    int            // 切割日志方式 0-不切割，1-按天，2-按小时
-    file        *os.File       // file
-    callDepth   int            // runtime.Caller depth
-    asyncLogger *asyncFile
-    asyncKafka  *asyncKafka
+    logType     int             // 写日志方式 1-同步写文件，2-异步写文件，3-异步写kafka
+    logLevel    int32           // 日志级别，运行时通过SetLevel原子修改
+    revertMu    sync.Mutex      // 保护 revertTimer、revertLevel
+    revertTimer *time.Timer     // 自动恢复日志级别
+    revertLevel Level
+    splitLog    int             // 切割日志方式 0-不切割，1-按天，2-按小时
+    callDepth   int             // runtime.Caller depth
+    flushLevel  Level           // 大于等于该级别的日志在调用返回前写入文件，0不开启
+    flushWait   time.Duration   // 崩溃、信号退出前等待日志写入的最长时间
+    format      int             // 日志格式 0-文本，1-json
+    timeFormat  string          // 时间格式，见 TIME_FORMAT_*
+    timeUTC     bool            // 使用UTC时间
+    template    *headerTemplate // 文本日志模板
+    name        string          // logger名称
+    needCaller  bool            // 日志头需要调用位置
+    stackLevel  Level           // 大于等于该级别的日志记录调用堆栈，0不开启
+    outputs     []*output       // 日志输出，每个输出独立队列
+    vmodule     []vmoduleRule   // 按文件覆盖日志级别
+    vmoduleMin  Level           // vmodule 规则中最低的级别
+    vmoduleMax  Level           // vmodule 规则中最高的级别
+    callSites   *pcSlots        // vmoduleEntry of call sites
+    sampler     *sampler        // 按调用位置采样、限流，nil不开启
+    dedup       *dedup          // 合并重复日志，nil不开启
+    redactor    *redactor       // 敏感信息脱敏，nil不开启
     flag        int
     queueSize   int
-    logQueue    chan []byte // log queue
-    queueQuit   chan bool
     pid         int
+    errHandler  ErrorHandler
 }
 
+// log record in queue
+type logRecord struct {
+    level  Level           // log level
+    time   time.Time       // log time
+    data   []byte          // formatted log line without trailing newline
+    buf    *logBuffer      // pooled buffer of data, nil when data is not pooled
+    flush  *sync.WaitGroup // at or above FlushLevel, done when written by async file outputs
+    marker bool            // Flush marker without data, done when records before it are written
+    msg    int32           // message offset in data of text records, 0 when unknown
+    fields int32           // offset after message of text records
+    id     uint64          // kafka message sequence, kept when retried
+}
+
+// internal event
+type Event struct {
+    Name string // event name, see EVENT_*
+    Msg  string // event detail
+    Err  error  // nil for informational events
+}
+
+// internal event handler
+type ErrorHandler func(e Event)
+
 const (
     L_Time                        = 1 << iota             // log time e.g: 2020-07-13 17:02:42.274391 +0800 CST
     L_LEVEL                                               // log level [INFO]
@@ -77,57 +139,105 @@ const (
     WRITE_LOG_TYPE_FILE           int         = 1         // write log file
     WRITE_LOG_TYPE_AFILE          int         = 2         // async write log file
     WRITE_LOG_TYPE_KAFKA          int         = 3         // async write kafka
-    WRITE_LOG_TYPE_FILE_AND_KAFKA int         = 4         // kafka and file
+    WRITE_LOG_TYPE_FILE_AND_KAFKA int         = 4         // kafka and file, same as Outputs: []int{WRITE_LOG_TYPE_FILE, WRITE_LOG_TYPE_KAFKA}
+    WRITE_LOG_TYPE_SYSLOG         int         = 5         // async write syslog
+    WRITE_LOG_TYPE_HTTP           int         = 6         // async batch post http
+    WRITE_LOG_TYPE_STREAM         int         = 7         // async write tcp/unix stream
+    WRITE_LOG_TYPE_CONSOLE        int         = 8         // async write stdout/stderr with colors
+)
+
+const (
+    EVENT_KAFKA_INIT  string = "kafka_init"  // kafka producer created
+    EVENT_KAFKA_SEND  string = "kafka_send"  // send kafka failed
+    EVENT_SYSLOG_SEND string = "syslog_send" // send syslog failed, reconnect or drop
+    EVENT_HTTP_SEND   string = "http_send"   // post http failed, retry or drop
+    EVENT_STREAM_SEND string = "stream_send" // write stream failed, reconnect or drop
+    EVENT_FLUSH       string = "flush"       // flush buffer to file failed
+    EVENT_ROTATE      string = "rotate"      // split log file
+    EVENT_REOPEN      string = "reopen"      // reopen log file after write failed
+    EVENT_QUIT        string = "quit"        // async queue quit progress
 )
 
 func New(s LogConfig) *Logger {
-    var err error
     logger := defaultLoggerConfig()
-    logger.logLevel = s.Level
+    logger.logLevel = int32(s.Level)
     logger.logType = s.Type
     logger.flag = s.Flag
     logger.queueSize = s.QueueSize
-
-    if logger.logType != WRITE_LOG_TYPE_KAFKA {
-        if s.FileFullPath == "" {
-            s.FileFullPath = DEFAULT_LOG
+    logger.flushLevel = s.FlushLevel
+    logger.format = s.Format
+    logger.timeFormat = s.TimeFormat
+    logger.timeUTC = s.TimeUTC
+    logger.name = s.Name
+    logger.needCaller = logger.flag&(L_LONG_FILE|L_SHORT_FILE) != 0
+
+    if s.Template != "" && logger.format == LOG_FORMAT_TEXT {
+        var err error
+        if logger.template, err = parseTemplate(s.Template); err != nil {
+            panic("template error: " + err.Error())
         }
+        logger.needCaller = logger.template.needCaller()
     }
+    logger.stackLevel = s.StackLevel
+    logger.sampler = newSampler(s.Sampling)
+    logger.redactor = newRedactor(s.Redact)
+    logger.dedup = newDedup(s.Dedup, func(rs repeatSummary) { logger.writeSummary(rs) })
 
-    if logger.logType == WRITE_LOG_TYPE_FILE || logger.logType == WRITE_LOG_TYPE_FILE_AND_KAFKA {
+    if logger.format != LOG_FORMAT_TEXT && logger.format != LOG_FORMAT_JSON {
+        panic("unknown log format: " + strconv.Itoa(logger.format))
+    }
 
-        if logger.file, err = os.OpenFile(s.FileFullPath, os.O_RDWR|os.O_SYNC|os.O_CREATE|os.O_APPEND, 0644);
-            err != nil {
-            panic("open log file:" + s.FileFullPath + " error: " + err.Error())
-        }
+    if s.FlushTimeout > 0 {
+        logger.flushWait = s.FlushTimeout
     }
 
-    if logger.logType == WRITE_LOG_TYPE_AFILE {
-        if logger.queueSize == 0 {
-            logger.queueSize = 10000
-        }
+    if s.ErrorHandler != nil {
+        logger.errHandler = s.ErrorHandler
+    }
 
-        logger.logQueue = make(chan []byte, s.QueueSize)
-        logger.asyncLogger = newAsyncFile(s.FileFullPath, s.SplitLogType, s.BufferSize, logger.logQueue)
+    if logger.queueSize == 0 {
+        logger.queueSize = 10000
+    }
 
+    if s.FileFullPath == "" {
+        s.FileFullPath = DEFAULT_LOG
     }
 
-    if logger.logType == WRITE_LOG_TYPE_KAFKA || logger.logType == WRITE_LOG_TYPE_FILE_AND_KAFKA {
-        if logger.queueSize == 0 {
-            logger.queueSize = 10000
+    outputs := s.Outputs
+    if len(outputs) == 0 {
+        if s.Type == WRITE_LOG_TYPE_FILE_AND_KAFKA {
+            outputs = []int{WRITE_LOG_TYPE_FILE, WRITE_LOG_TYPE_KAFKA}
+        } else {
+            outputs = []int{s.Type}
         }
+    }
 
-        logger.logQueue = make(chan []byte, s.QueueSize)
-        logger.queueQuit = make(chan bool)
-        logger.asyncKafka = newAsyncKafka(s.KafkaConfig.Brokers, s.KafkaConfig.Topic, s.KafkaConfig.Version,
-            s.KafkaConfig.Compression, s.KafkaConfig.RequiredAcks, s.KafkaConfig.MaxMessageBytes, logger.logQueue)
-
+    for _, logType := range outputs {
+        logger.outputs = append(logger.outputs, newOutput(logType, s, logger.queueSize, logger.errHandler))
     }
 
     if s.CallDepth > 0 {
         logger.callDepth = s.CallDepth
     }
 
+    if s.VModule != "" {
+        var err error
+        if logger.vmodule, err = parseVModule(s.VModule); err != nil {
+            panic("vmodule error: " + err.Error())
+        }
+        logger.callSites = new(pcSlots)
+
+        for i, rule := range logger.vmodule {
+            if i == 0 || rule.level < logger.vmoduleMin {
+                logger.vmoduleMin = rule.level
+            }
+
+            if i == 0 || rule.level > logger.vmoduleMax {
+                logger.vmoduleMax = rule.level
+            }
+        }
+    }
+
     logger.pid = syscall.Getpid()
 
     return logger
@@ -136,177 +246,422 @@ func New(s LogConfig) *Logger {
 //
 func defaultLoggerConfig() *Logger {
     return &Logger{
-        file:     nil,
-        logLevel: 0,
-        levelMap: map[int]string{
-            0: "PANIC",
-            1: "FATAL",
-            2: "ERROR",
-            3: "WARN",
-            4: "INFO",
-            5: "DEBUG",
-        },
-        callDepth: 2,
+        logLevel:   int32(LEVEL_DEBUG),
+        callDepth:  2,
+        flushWait:  5 * time.Second,
+        errHandler: defaultErrorHandler,
     }
 }
 
-// format log header
-func (c *Logger) formatHeader(t time.Time, lvl int) (header string) {
+// default error handler, only errors are written to stderr
+func defaultErrorHandler(e Event) {
+    if e.Err == nil {
+        return
+    }
+
+    fmt.Fprintf(os.Stderr, "asynclog: %s: %s %v\n", e.Name, e.Msg, e.Err)
+}
+
+// append log header
+func (c *Logger) appendHeader(b []byte, t time.Time, lvl Level, cl logCaller) []byte {
+    if c.format == LOG_FORMAT_JSON {
+        return c.appendJSONHeader(b, t, lvl, cl)
+    }
+
+    if c.template != nil {
+        return c.appendTemplate(b, c.template.head, logRecord{time: t, level: lvl}, cl)
+    }
 
     if c.flag&L_Time != 0 {
-        header = fmt.Sprintf("%v ", t.Local())
+        b = c.appendTimestamp(b, t)
+        b = append(b, ' ')
     }
 
     if c.flag&L_PID != 0 {
-        header += fmt.Sprintf("[%d] ", c.pid)
+        b = append(b, '[')
+        b = strconv.AppendInt(b, int64(c.pid), 10)
+        b = append(b, "] "...)
     }
 
     if c.flag&L_LEVEL != 0 {
-        header += "[" + c.levelMap[lvl] + "] "
+        b = append(b, '[')
+        b = append(b, lvl.String()...)
+        b = append(b, "] "...)
     }
 
     if c.flag&(L_LONG_FILE|L_SHORT_FILE) != 0 {
-        var (
-            ok   bool
-            file string
-            line int
-        )
-
-        c.Lock()
-        _, file, line, ok = runtime.Caller(c.callDepth)
-        if !ok {
-            file = "???"
-            line = 0
-        }
-        c.Unlock()
-
-        if c.flag&L_SHORT_FILE != 0 {
-            short := file
-            for i := len(file) - 1; i > 0; i-- {
-                if file[i] == '/' {
-                    short = file[i+1:]
-                    break
-                }
-            }
-            file = short
-        }
-        header += fmt.Sprintf("%s:%d ", file, line)
+        b = append(b, c.callerFile(cl)...)
+        b = append(b, ':')
+        b = strconv.AppendInt(b, int64(cl.line), 10)
+        b = append(b, ' ')
+    }
+
+    return b
+}
+
+// caller file by L_SHORT_FILE or L_LONG_FILE
+func (c *Logger) callerFile(cl logCaller) string {
+    if c.flag&L_SHORT_FILE != 0 {
+        return shortFile(cl.file)
     }
 
-    return header
+    return cl.file
 }
 
 func (c *Logger) Panic(args ...interface{}) {
     s := fmt.Sprint(args...)
-    c.Write(0, s)
+    if ok, cl := c.enabled(LEVEL_PANIC, c.callDepth); ok {
+        c.write(LEVEL_PANIC, cl, s)
+    }
     c.AsyncQuite()
     panic(s)
 }
 
 func (c *Logger) Panicf(format string, args ...interface{}) {
     s := fmt.Sprintf(format, args...)
-    c.Write(0, s)
+    if ok, cl := c.enabled(LEVEL_PANIC, c.callDepth); ok {
+        c.write(LEVEL_PANIC, cl, s)
+    }
     c.AsyncQuite()
     panic(s)
 }
 
 func (c *Logger) Fatal(args ...interface{}) {
-    s := fmt.Sprint(args...)
-    c.Write(1, s)
+    if ok, cl := c.enabled(LEVEL_FATAL, c.callDepth); ok {
+        c.writeArgs(LEVEL_FATAL, cl, args)
+    }
     c.AsyncQuite()
     os.Exit(1)
 }
 
 func (c *Logger) Fatalf(format string, args ...interface{}) {
-    s := fmt.Sprintf(format, args...)
-    c.Write(1, s)
+    if ok, cl := c.enabled(LEVEL_FATAL, c.callDepth); ok {
+        c.writef(LEVEL_FATAL, cl, format, args)
+    }
     c.AsyncQuite()
     os.Exit(1)
 }
 
 func (c *Logger) Error(args ...interface{}) {
-    s := fmt.Sprint(args...)
-    c.Write(2, s)
+    if ok, cl := c.enabled(LEVEL_ERROR, c.callDepth); ok {
+        c.writeArgs(LEVEL_ERROR, cl, args)
+    }
 }
 
 func (c *Logger) Errorf(format string, args ...interface{}) {
-    s := fmt.Sprintf(format, args...)
-    c.Write(2, s)
+    if ok, cl := c.enabled(LEVEL_ERROR, c.callDepth); ok {
+        c.writef(LEVEL_ERROR, cl, format, args)
+    }
+}
+
+// error with call stack whatever StackLevel is
+func (c *Logger) ErrorStack(args ...interface{}) {
+    if ok, cl := c.enabledStack(LEVEL_ERROR, c.callDepth); ok {
+        c.writeArgs(LEVEL_ERROR, cl, args)
+    }
+}
+
+func (c *Logger) ErrorStackf(format string, args ...interface{}) {
+    if ok, cl := c.enabledStack(LEVEL_ERROR, c.callDepth); ok {
+        c.writef(LEVEL_ERROR, cl, format, args)
+    }
+}
+
+// fn is only called when the level is enabled
+func (c *Logger) Errorfn(fn func() string) {
+    if ok, cl := c.enabled(LEVEL_ERROR, c.callDepth); ok {
+        c.write(LEVEL_ERROR, cl, fn())
+    }
 }
 
 func (c *Logger) Warn(args ...interface{}) {
-    s := fmt.Sprint(args...)
-    c.Write(3, s)
+    if ok, cl := c.enabled(LEVEL_WARN, c.callDepth); ok {
+        c.writeArgs(LEVEL_WARN, cl, args)
+    }
 }
 
 func (c *Logger) Warnf(format string, args ...interface{}) {
-    s := fmt.Sprintf(format, args...)
-    c.Write(3, s)
+    if ok, cl := c.enabled(LEVEL_WARN, c.callDepth); ok {
+        c.writef(LEVEL_WARN, cl, format, args)
+    }
+}
+
+// fn is only called when the level is enabled
+func (c *Logger) Warnfn(fn func() string) {
+    if ok, cl := c.enabled(LEVEL_WARN, c.callDepth); ok {
+        c.write(LEVEL_WARN, cl, fn())
+    }
 }
 
 func (c *Logger) Info(args ...interface{}) {
-    s := fmt.Sprint(args...)
-    c.Write(4, s)
+    if ok, cl := c.enabled(LEVEL_INFO, c.callDepth); ok {
+        c.writeArgs(LEVEL_INFO, cl, args)
+    }
 }
 
 func (c *Logger) Infof(format string, args ...interface{}) {
-    s := fmt.Sprintf(format, args...)
-    c.Write(4, s)
+    if ok, cl := c.enabled(LEVEL_INFO, c.callDepth); ok {
+        c.writef(LEVEL_INFO, cl, format, args)
+    }
+}
+
+// fn is only called when the level is enabled
+func (c *Logger) Infofn(fn func() string) {
+    if ok, cl := c.enabled(LEVEL_INFO, c.callDepth); ok {
+        c.write(LEVEL_INFO, cl, fn())
+    }
 }
 
 func (c *Logger) Debug(args ...interface{}) {
-    s := fmt.Sprint(args...)
-    c.Write(5, s)
+    if ok, cl := c.enabled(LEVEL_DEBUG, c.callDepth); ok {
+        c.writeArgs(LEVEL_DEBUG, cl, args)
+    }
 }
 
 func (c *Logger) Debugf(format string, args ...interface{}) {
-    s := fmt.Sprintf(format, args...)
-    c.Write(5, s)
+    if ok, cl := c.enabled(LEVEL_DEBUG, c.callDepth); ok {
+        c.writef(LEVEL_DEBUG, cl, format, args)
+    }
 }
 
-func (c *Logger) Write(level int, s string) (n int, err error) {
-    if c.logLevel <= level {
-        header := c.formatHeader(time.Now(), level)
-        data := []byte(header + s)
-        if c.logType > WRITE_LOG_TYPE_FILE {
-            err := c.WriteQueue(data)
-            n = len(s)
-            return n, err
-        }
+// fn is only called when the level is enabled
+func (c *Logger) Debugfn(fn func() string) {
+    if ok, cl := c.enabled(LEVEL_DEBUG, c.callDepth); ok {
+        c.write(LEVEL_DEBUG, cl, fn())
+    }
+}
 
-        if c.logType == WRITE_LOG_TYPE_FILE_AND_KAFKA || c.logType == WRITE_LOG_TYPE_FILE {
-            br := []byte("\n")
-            for i := 0; i < len(br); i++ {
-                data = append(data, br[i])
-            }
+// log with custom level
+func (c *Logger) Log(level Level, args ...interface{}) {
+    if ok, cl := c.enabled(level, c.callDepth); ok {
+        c.writeArgs(level, cl, args)
+    }
+}
 
-            return c.file.Write(data)
+func (c *Logger) Logf(level Level, format string, args ...interface{}) {
+    if ok, cl := c.enabled(level, c.callDepth); ok {
+        c.writef(level, cl, format, args)
+    }
+}
+
+// whether a record of level would be written by the code calling Enabled
+// only level and vmodule are checked, nothing is captured for the check itself
+func (c *Logger) Enabled(level Level) bool {
+    ok, _ := c.levelEnabled(level, c.callDepth)
+    return ok
+}
+
+// check level and vmodule, returns the caller when it has been looked up
+// skip is counted from levelEnabled, e.g. 2 is the code calling Enabled
+func (c *Logger) levelEnabled(level Level, skip int) (bool, logCaller) {
+    var cl logCaller
+
+    enabled := c.Level() <= level
+
+    // look up the call site only when a vmodule rule may change the result
+    if len(c.vmodule) > 0 && (enabled && level < c.vmoduleMax || !enabled && level >= c.vmoduleMin) {
+        cl = c.caller(skip)
+        if l, ok := c.vmoduleLevel(cl.pc, cl.file); ok {
+            enabled = l <= level
         }
     }
 
+    return enabled, cl
+}
+
+// check a record about to be written, returns its caller and call stack when needed
+// skip is counted from enabled, e.g. 2 is the code calling Info
+func (c *Logger) enabled(level Level, skip int) (bool, logCaller) {
+    enabled, cl := c.levelEnabled(level, skip+1)
+    if !enabled {
+        return false, cl
+    }
+
+    if cl.file == "" && (c.needCaller || c.dedup != nil || c.sampler != nil && level <= c.sampler.MaxLevel) {
+        cl = c.caller(skip)
+    }
+
+    if !c.sample(level, &cl) {
+        return false, cl
+    }
+
+    if c.stackLevel != LEVEL_DEBUG && level >= c.stackLevel {
+        cl.stack = c.callers(skip)
+    }
+
+    return true, cl
+}
+
+// sample a record about to be written, keeps the dropped count of its call site in cl
+// Enabled never samples, so checking it before logging does not use up the call site's quota
+func (c *Logger) sample(level Level, cl *logCaller) bool {
+    if c.sampler == nil || level > c.sampler.MaxLevel {
+        return true
+    }
+
+    ok, dropped := c.sampler.sample(cl.pc, level, time.Now())
+    cl.dropped = dropped
+
+    return ok
+}
+
+// enabled with call stack
+func (c *Logger) enabledStack(level Level, skip int) (bool, logCaller) {
+    ok, cl := c.enabled(level, skip+1)
+    if ok && cl.stack == nil {
+        cl.stack = c.callers(skip)
+    }
+
+    return ok, cl
+}
+
+func (c *Logger) Write(level Level, s string) (n int, err error) {
+    if ok, cl := c.enabled(level, c.callDepth); ok {
+        return len(s), c.write(level, cl, s)
+    }
+
     return 0, nil
 }
 
+// write message s
+func (c *Logger) write(level Level, cl logCaller, s string) error {
+    r := c.newRecord(level, cl)
+    msgStart := len(r.buf.b)
+    r.buf.b = append(r.buf.b, s...)
+    r = c.markMessage(r, msgStart)
+    c.endRecord(r, msgStart, cl)
+
+    return c.writeDedup(r, msgStart, cl)
+}
+
+// write fmt.Sprint(args...)
+func (c *Logger) writeArgs(level Level, cl logCaller, args []interface{}) error {
+    r := c.newRecord(level, cl)
+    msgStart := len(r.buf.b)
+    fmt.Fprint(r.buf, args...)
+    r = c.markMessage(r, msgStart)
+    c.endRecord(r, msgStart, cl)
+
+    return c.writeDedup(r, msgStart, cl)
+}
+
+// write fmt.Sprintf(format, args...)
+func (c *Logger) writef(level Level, cl logCaller, format string, args []interface{}) error {
+    r := c.newRecord(level, cl)
+    msgStart := len(r.buf.b)
+    fmt.Fprintf(r.buf, format, args...)
+    r = c.markMessage(r, msgStart)
+    c.endRecord(r, msgStart, cl)
+
+    return c.writeDedup(r, msgStart, cl)
+}
+
+// new record with header in a pooled buffer, message is appended to r.buf by the caller and finished by endRecord
+func (c *Logger) newRecord(level Level, cl logCaller) logRecord {
+    r := logRecord{level: level, time: time.Now(), buf: getBuffer()}
+    r.buf.b = c.appendHeader(r.buf.b, r.time, level, cl)
+
+    return r
+}
+
 // write queue
 func (c *Logger) WriteQueue(data []byte) error {
-    if len(c.logQueue) >= c.queueSize {
-        return errors.New("log queue has reaches maximum")
+    if c.redactor != nil {
+        data = c.redactor.redact(data)
     }
 
-    c.logQueue <- data
+    return c.writeRecord(logRecord{level: LEVEL_INFO, time: time.Now(), data: data})
+}
 
-    return nil
+// write record to every output, returns the first error
+// every output owns one reference of the pooled buffer and releases it when done
+func (c *Logger) writeRecord(r logRecord) (err error) {
+    if r.buf != nil {
+        // keep a '\n' right after data for file outputs, see logRecord.line
+        // append first, a full buffer moves to a new array
+        r.buf.b = append(r.buf.b, '\n')
+        r.data = r.buf.b[:len(r.buf.b)-1]
+        r.buf.refs = int32(len(c.outputs))
+    }
+
+    if c.flushLevel != LEVEL_DEBUG && r.level >= c.flushLevel {
+        r.flush = new(sync.WaitGroup)
+        defer r.flush.Wait()
+    }
+
+    for _, o := range c.outputs {
+        if r.flush != nil && o.logType == WRITE_LOG_TYPE_AFILE {
+            r.flush.Add(1)
+        }
+
+        if e := o.write(r); e != nil && err == nil {
+            err = e
+        }
+    }
+
+    return err
+}
+
+// wait until records written before Flush are written by every output
+// files are fsynced, kafka messages acked, http batches and stream buffers sent
+func (c *Logger) Flush(ctx context.Context) error {
+    // summary goes before the marker
+    c.flushRepeated()
+
+    var (
+        err  error
+        done = make(chan struct{})
+        r    = logRecord{time: time.Now(), flush: new(sync.WaitGroup), marker: true}
+    )
+
+    r.flush.Add(len(c.outputs))
+    for _, o := range c.outputs {
+        if e := o.flush(ctx, r); e != nil && err == nil {
+            err = e
+        }
+    }
+
+    go func() {
+        r.flush.Wait()
+        close(done)
+    }()
+
+    select {
+    case <-done:
+        return err
+    case <-ctx.Done():
+        return ctx.Err()
+    }
 }
 
-// quite write log
+// flush without deadline
+func (c *Logger) Sync() error {
+    return c.Flush(context.Background())
+}
+
+// quite write log, wait all async outputs
 func (c *Logger) AsyncQuite() bool {
-    if c.logType == WRITE_LOG_TYPE_KAFKA {
-        return c.asyncKafka.SignQuite()
-    } else {
-        return c.asyncLogger.SignQuite()
+    c.flushRepeated()
+
+    ok := true
+    for _, o := range c.outputs {
+        if !o.quit() {
+            ok = false
+        }
     }
+
+    return ok
 }
 
-func (c *Logger) Close() error {
-    return c.file.Close()
+// close sync write files
+func (c *Logger) Close() (err error) {
+    c.flushRepeated()
+
+    for _, o := range c.outputs {
+        if e := o.close(); e != nil && err == nil {
+            err = e
+        }
+    }
+
+    return err
 }
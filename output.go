@@ -0,0 +1,209 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  output.go
+ * @version: 1.0.0
+ * @Date: 2026/10/19 下午7:30
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "context"
+    "errors"
+    "os"
+    "strconv"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// async output, quit when the program exits
+type asyncSink interface {
+    SignQuite() bool
+}
+
+// log output, every output has its own queue so a slow one never stalls the others
+type output struct {
+    logType  int
+    file     *os.File       // sync write file
+    fileMu   sync.Mutex     // guards syncer of sync write file
+    syncer   fileSyncer
+    logQueue chan logRecord // async outputs queue
+    sharded  *shardedQueue  // sharded queue merged into logQueue, nil for channel queue
+    sink     asyncSink
+    quitted  int32 // async output quit, records are no longer written
+}
+
+var errQueueFull = errors.New("log queue has reaches maximum")
+
+// new output
+func newOutput(logType int, s LogConfig, queueSize int, eh ErrorHandler) *output {
+    var err error
+    o := &output{logType: logType}
+
+    if logType == WRITE_LOG_TYPE_FILE {
+        o.syncer = newFileSyncer(s)
+        if o.file, err = o.syncer.open(s.FileFullPath); err != nil {
+            panic("open log file:" + s.FileFullPath + " error: " + err.Error())
+        }
+
+        return o
+    }
+
+    switch s.QueueType {
+    case QUEUE_TYPE_CHANNEL:
+        o.logQueue = make(chan logRecord, queueSize)
+
+    case QUEUE_TYPE_SHARDED:
+        o.logQueue = make(chan logRecord, shardedQueueOut)
+        o.sharded = newShardedQueue(s.QueueShards, queueSize, o.logQueue)
+
+    default:
+        panic("unknown queue type: " + strconv.Itoa(s.QueueType))
+    }
+
+    switch logType {
+    case WRITE_LOG_TYPE_AFILE:
+        o.sink = newAsyncFile(s, o.logQueue, eh)
+
+    case WRITE_LOG_TYPE_KAFKA:
+        o.sink = newAsyncKafka(s.KafkaConfig.Brokers, s.KafkaConfig.Topic, s.KafkaConfig.Version,
+            s.KafkaConfig.Compression, s.KafkaConfig.RequiredAcks, s.KafkaConfig.MaxMessageBytes, o.logQueue, eh)
+
+    case WRITE_LOG_TYPE_SYSLOG:
+        o.sink = newAsyncSyslog(s.SyslogConfig, o.logQueue, eh)
+
+    case WRITE_LOG_TYPE_HTTP:
+        o.sink = newAsyncHttp(s.HttpConfig, o.logQueue, eh)
+
+    case WRITE_LOG_TYPE_STREAM:
+        o.sink = newAsyncStream(s.StreamConfig, o.logQueue, eh)
+
+    case WRITE_LOG_TYPE_CONSOLE:
+        o.sink = newAsyncConsole(s.ConsoleConfig, nil, o.logQueue, eh)
+
+    default:
+        panic("unknown log type: " + strconv.Itoa(logType))
+    }
+
+    return o
+}
+
+// write record, async outputs never block when the queue is full
+// output owns one reference of the record buffer, async sinks release it when done
+func (o *output) write(r logRecord) error {
+    if o.file != nil {
+        n, err := o.file.Write(r.line())
+        r.release()
+
+        if err == nil && o.syncer.mode == DURABILITY_FSYNC {
+            o.fileMu.Lock()
+            if err = o.syncer.wrote(o.file, n); err == nil && r.flush != nil {
+                err = o.syncer.sync(o.file)
+            }
+            o.fileMu.Unlock()
+        }
+
+        return err
+    }
+
+    // async file outputs write flush records before the caller returns
+    if r.flush != nil && o.logType == WRITE_LOG_TYPE_AFILE && atomic.LoadInt32(&o.quitted) != 0 {
+        r.flush.Done()
+        r.flush = nil
+    }
+
+    if o.sharded != nil {
+        if o.sharded.push(r) {
+            return nil
+        }
+    } else {
+        select {
+        case o.logQueue <- r:
+            return nil
+        default:
+        }
+    }
+
+    if r.flush != nil && o.logType == WRITE_LOG_TYPE_AFILE {
+        r.flush.Done()
+    }
+    r.release()
+
+    return errQueueFull
+}
+
+// send flush marker, sync files are fsynced at once
+func (o *output) flush(ctx context.Context, r logRecord) error {
+    if o.file != nil {
+        o.fileMu.Lock()
+        err := o.syncer.force(o.file)
+        o.fileMu.Unlock()
+
+        r.flush.Done()
+        return err
+    }
+
+    if atomic.LoadInt32(&o.quitted) != 0 {
+        r.flush.Done()
+        return nil
+    }
+
+    // markers wait for room in the queue
+    if o.sharded != nil {
+        for !o.sharded.push(r) {
+            select {
+            case <-ctx.Done():
+                r.flush.Done()
+                return ctx.Err()
+            case <-time.After(time.Millisecond):
+            }
+        }
+
+        return nil
+    }
+
+    select {
+    case o.logQueue <- r:
+        return nil
+    case <-ctx.Done():
+        r.flush.Done()
+        return ctx.Err()
+    }
+}
+
+// quit async output, only the first call stops the sink
+func (o *output) quit() bool {
+    if o.sink == nil {
+        return true
+    }
+
+    // sinks stop after the first quit, later calls have nothing to wait for
+    if !atomic.CompareAndSwapInt32(&o.quitted, 0, 1) {
+        return true
+    }
+
+    if o.sharded != nil {
+        o.sharded.close()
+    }
+
+    return o.sink.SignQuite()
+}
+
+// close sync file
+func (o *output) close() error {
+    if o.file == nil {
+        return nil
+    }
+
+    o.fileMu.Lock()
+    err := o.syncer.sync(o.file)
+    o.fileMu.Unlock()
+
+    if cerr := o.file.Close(); err == nil {
+        err = cerr
+    }
+
+    return err
+}
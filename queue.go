@@ -0,0 +1,246 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  queue.go
+ * @version: 1.0.0
+ * @Date: 2026/10/23 上午11:20
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "runtime"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+/**
+ * 分片无锁队列
+ * 多个goroutine写不同的分片（按P分配），避免所有goroutine竞争同一个channel
+ * 合并goroutine按日志时间从各分片头部取最早的日志，写入输出自己的channel
+ */
+
+const (
+    QUEUE_TYPE_CHANNEL int = 0 // one channel per output
+    QUEUE_TYPE_SHARDED int = 1 // sharded lock free ring buffers merged by time
+
+    shardedQueueOut = 1024 // merged records waiting for the output
+)
+
+type shardedQueue struct {
+    shards []*ringShard
+    next   uint32    // shard of the next new hint
+    hints  sync.Pool // *shardHint, per P so goroutines on the same P share a shard
+    out    chan logRecord
+    wake   chan struct{}
+    quit   chan bool
+    closed int32 // push fails after close
+}
+
+type shardHint struct {
+    shard int
+}
+
+// bounded multi-producer single-consumer ring buffer
+type ringShard struct {
+    tail    uint64 // next write position, shared by producers
+    pushing int32  // producers pushing through this shard, close waits for them
+    _       [52]byte
+    head  uint64 // next read position, only used by the merge goroutine
+    mask  uint64
+    cells []ringCell
+}
+
+type ringCell struct {
+    seq uint64 // == pos: writable, == pos+1: readable
+    r   logRecord
+}
+
+// new sharded queue, size is the total capacity of all shards
+func newShardedQueue(shards, size int, out chan logRecord) *shardedQueue {
+    if shards <= 0 {
+        shards = runtime.GOMAXPROCS(0)
+    }
+
+    q := &shardedQueue{
+        out:  out,
+        wake: make(chan struct{}, 1),
+        quit: make(chan bool),
+    }
+
+    // shard capacity is rounded up to power of 2
+    capacity := 2
+    for capacity*shards < size {
+        capacity *= 2
+    }
+
+    for i := 0; i < shards; i++ {
+        s := &ringShard{mask: uint64(capacity - 1), cells: make([]ringCell, capacity)}
+        for j := range s.cells {
+            s.cells[j].seq = uint64(j)
+        }
+        q.shards = append(q.shards, s)
+    }
+
+    q.hints.New = func() interface{} {
+        return &shardHint{shard: int(atomic.AddUint32(&q.next, 1)) % len(q.shards)}
+    }
+
+    go q.merge()
+
+    return q
+}
+
+// push record, false when all shards are full or the queue is closed
+func (q *shardedQueue) push(r logRecord) bool {
+    h := q.hints.Get().(*shardHint)
+    shard := h.shard
+    q.hints.Put(h)
+
+    // counted before checking closed: either close sees this push and waits for it,
+    // or this push sees closed, so no record is published after the final drain
+    pushing := &q.shards[shard].pushing
+    atomic.AddInt32(pushing, 1)
+    defer atomic.AddInt32(pushing, -1)
+
+    if atomic.LoadInt32(&q.closed) != 0 {
+        return false
+    }
+
+    for i := 0; i < len(q.shards); i++ {
+        if q.shards[(shard+i)%len(q.shards)].push(r) {
+            // non-blocking send on a full channel does not take its lock
+            select {
+            case q.wake <- struct{}{}:
+            default:
+            }
+
+            return true
+        }
+    }
+
+    return false
+}
+
+// merge shards into out, the earliest head goes first
+func (q *shardedQueue) merge() {
+    for {
+        if q.mergeOne() {
+            continue
+        }
+
+        select {
+        case <-q.wake:
+
+        case <-q.quit:
+            for q.mergeOne() {
+            }
+
+            q.quit <- true
+            return
+        }
+    }
+}
+
+// move the earliest head records to out, false when all shards are empty
+// records of the earliest shard are moved until they are later than the next shard head
+func (q *shardedQueue) mergeOne() bool {
+    var (
+        best     *ringShard
+        bestTime time.Time
+        nextTime time.Time
+        hasNext  bool
+    )
+
+    for _, s := range q.shards {
+        r, ok := s.peek()
+        if !ok {
+            continue
+        }
+
+        switch {
+        case best == nil:
+            best, bestTime = s, r.time
+
+        case r.time.Before(bestTime):
+            nextTime, hasNext = bestTime, true
+            best, bestTime = s, r.time
+
+        case !hasNext || r.time.Before(nextTime):
+            nextTime, hasNext = r.time, true
+        }
+    }
+
+    if best == nil {
+        return false
+    }
+
+    for {
+        q.out <- best.pop()
+
+        r, ok := best.peek()
+        if !ok || (hasNext && r.time.After(nextTime)) {
+            return true
+        }
+    }
+}
+
+// move all records to out and stop merging, only the first call waits for merge
+func (q *shardedQueue) close() {
+    if !atomic.CompareAndSwapInt32(&q.closed, 0, 1) {
+        return
+    }
+
+    // wait for pushes that started before closed was set
+    for _, s := range q.shards {
+        for atomic.LoadInt32(&s.pushing) != 0 {
+            runtime.Gosched()
+        }
+    }
+
+    q.quit <- true
+    <-q.quit
+}
+
+// push record, false when full
+func (s *ringShard) push(r logRecord) bool {
+    for {
+        pos := atomic.LoadUint64(&s.tail)
+        cell := &s.cells[pos&s.mask]
+        seq := atomic.LoadUint64(&cell.seq)
+
+        switch {
+        case seq == pos:
+            if atomic.CompareAndSwapUint64(&s.tail, pos, pos+1) {
+                cell.r = r
+                atomic.StoreUint64(&cell.seq, pos+1)
+                return true
+            }
+
+        case seq < pos:
+            return false
+        }
+    }
+}
+
+// head record, consumer only
+func (s *ringShard) peek() (*logRecord, bool) {
+    cell := &s.cells[s.head&s.mask]
+    if atomic.LoadUint64(&cell.seq) != s.head+1 {
+        return nil, false
+    }
+
+    return &cell.r, true
+}
+
+// pop head record after peek, consumer only
+func (s *ringShard) pop() logRecord {
+    cell := &s.cells[s.head&s.mask]
+    r := cell.r
+    cell.r = logRecord{}
+    atomic.StoreUint64(&cell.seq, s.head+s.mask+1)
+    s.head++
+
+    return r
+}
@@ -0,0 +1,198 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  redact.go
+ * @version: 1.0.0
+ * @Date: 2026/10/27 下午4:20
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+    "time"
+)
+
+/**
+ * 敏感信息脱敏
+ * 在生成日志时处理，所有输出（文件、kafka、http等）拿到的都是脱敏后的日志
+ * 字段名黑名单：键值对的值、消息中的 key=value、key: value 替换为Mask
+ * 正则：消息和字符串字段中匹配的内容替换为Mask
+ * 内置检测：银行卡号（Luhn校验）、邮箱、token（Bearer/Basic认证、JWT、AWS access key）
+ */
+
+// redact config
+type RedactConfig struct {
+    Fields    []string // 字段名黑名单，不区分大小写，如 DefaultRedactFields
+    Patterns  []string // 正则，消息和字符串字段中匹配的内容替换为Mask
+    Detectors int      // 内置检测 REDACT_CREDIT_CARD | REDACT_EMAIL | REDACT_TOKEN，或 REDACT_ALL
+    Mask      string   // 替换内容，默认 ***
+}
+
+const (
+    REDACT_CREDIT_CARD int = 1 << iota // card numbers passing the Luhn check
+    REDACT_EMAIL                       // email addresses
+    REDACT_TOKEN                       // bearer and basic credentials, JWTs, AWS access key ids
+    REDACT_ALL         = REDACT_CREDIT_CARD | REDACT_EMAIL | REDACT_TOKEN
+)
+
+// common secret field names
+var DefaultRedactFields = []string{
+    "password", "passwd", "pwd", "secret", "token", "access_token", "refresh_token",
+    "api_key", "apikey", "authorization", "cookie", "set-cookie",
+}
+
+var (
+    cardPattern  = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+    emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+    tokenPattern = regexp.MustCompile(`(?i)\b(?:bearer|basic)\s+[A-Za-z0-9._~+/=-]{8,}` +
+        `|\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+` + `|\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)
+)
+
+type redactor struct {
+    fields   map[string]bool // lower case denied field names
+    keyValue *regexp.Regexp  // denied key=value and key: value in text, the value is submatch 1
+    patterns []*regexp.Regexp
+    cards    bool
+    mask     string
+}
+
+// new redactor, nil when nothing is configured, a bad pattern panics
+func newRedactor(s RedactConfig) *redactor {
+    if len(s.Fields) == 0 && len(s.Patterns) == 0 && s.Detectors == 0 {
+        return nil
+    }
+
+    rd := &redactor{fields: make(map[string]bool), mask: s.Mask}
+    if rd.mask == "" {
+        rd.mask = "***"
+    }
+
+    if len(s.Fields) > 0 {
+        names := make([]string, 0, len(s.Fields))
+        for _, f := range s.Fields {
+            rd.fields[strings.ToLower(f)] = true
+            names = append(names, regexp.QuoteMeta(f))
+        }
+
+        rd.keyValue = regexp.MustCompile(`(?i)\b(?:` + strings.Join(names, "|") + `)\b"?\s*[=:]\s*("[^"]*"|[^\s,;&]+)`)
+    }
+
+    for _, p := range s.Patterns {
+        re, err := regexp.Compile(p)
+        if err != nil {
+            panic("redact pattern error: " + err.Error())
+        }
+        rd.patterns = append(rd.patterns, re)
+    }
+
+    if s.Detectors&REDACT_TOKEN != 0 {
+        rd.patterns = append(rd.patterns, tokenPattern)
+    }
+
+    if s.Detectors&REDACT_EMAIL != 0 {
+        rd.patterns = append(rd.patterns, emailPattern)
+    }
+
+    rd.cards = s.Detectors&REDACT_CREDIT_CARD != 0
+
+    return rd
+}
+
+// redact text, returns b itself when nothing matches
+func (rd *redactor) redact(b []byte) []byte {
+    if rd.keyValue != nil && rd.keyValue.Match(b) {
+        b = rd.keyValue.ReplaceAllFunc(b, func(kv []byte) []byte {
+            m := rd.keyValue.FindSubmatchIndex(kv)
+            return append(append(kv[:m[2]:m[2]], rd.mask...), kv[m[3]:]...)
+        })
+    }
+
+    for _, re := range rd.patterns {
+        if re.Match(b) {
+            b = re.ReplaceAllLiteral(b, []byte(rd.mask))
+        }
+    }
+
+    if rd.cards && cardPattern.Match(b) {
+        b = cardPattern.ReplaceAllFunc(b, func(card []byte) []byte {
+            if !luhn(card) {
+                return card
+            }
+
+            return []byte(rd.mask)
+        })
+    }
+
+    return b
+}
+
+// field value, masked when the key is denied or secrets are found in it
+func (rd *redactor) value(key string, v interface{}) interface{} {
+    if rd.fields[strings.ToLower(key)] {
+        return rd.mask
+    }
+
+    var s string
+
+    switch v := v.(type) {
+    case nil, bool, float32, float64, time.Duration, time.Time:
+        return v
+    case string:
+        s = v
+    case error:
+        s = v.Error()
+    case fmt.Stringer:
+        s = v.String()
+    default:
+        s = fmt.Sprint(v)
+    }
+
+    if m := rd.text(s); m != s {
+        return m
+    }
+
+    return v
+}
+
+// redact string
+func (rd *redactor) text(s string) string {
+    return string(rd.redact([]byte(s)))
+}
+
+// Luhn checksum of digits, spaces and dashes are skipped
+func luhn(card []byte) bool {
+    var sum, n int
+
+    for i := len(card) - 1; i >= 0; i-- {
+        if card[i] < '0' || card[i] > '9' {
+            continue
+        }
+
+        d := int(card[i] - '0')
+        if n%2 == 1 {
+            if d *= 2; d > 9 {
+                d -= 9
+            }
+        }
+        sum += d
+        n++
+    }
+
+    return n >= 13 && sum%10 == 0
+}
+
+// redact the message appended to r.buf from msgStart
+func (c *Logger) redactMessage(r logRecord, msgStart int) {
+    if c.redactor == nil {
+        return
+    }
+
+    // redact returns a new slice when something is masked
+    msg := r.buf.b[msgStart:]
+    if out := c.redactor.redact(msg); len(msg) > 0 && (len(out) != len(msg) || &out[0] != &msg[0]) {
+        r.buf.b = append(r.buf.b[:msgStart], out...)
+    }
+}
@@ -0,0 +1,134 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  sampling.go
+ * @version: 1.0.0
+ * @Date: 2026/10/26 下午3:10
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "sync"
+    "time"
+)
+
+/**
+ * 按调用位置采样、限流
+ * 每个调用位置的每个级别单独计数，在格式化和入队之前丢弃，热点循环打日志不会写满队列
+ * 被丢弃的条数记录在该调用位置下一条输出的日志中：suppressed=N
+ */
+
+// sampling config
+type SamplingConfig struct {
+    Initial    int           // 每个周期内每个调用位置前N条全部输出
+    Thereafter int           // 超过Initial后每M条输出1条，0表示全部丢弃
+    Tick       time.Duration // 采样周期，默认1s
+    Rate       float64       // 令牌桶限流，每个调用位置每秒最多输出的条数，0不限流
+    Burst      int           // 令牌桶容量，默认等于Rate
+    MaxLevel   Level         // 小于等于该级别的日志才采样、限流，默认LEVEL_WARN
+}
+
+type sampler struct {
+    SamplingConfig
+    shards [64]sampleShard
+}
+
+type sampleShard struct {
+    sync.Mutex
+    sites map[sampleKey]*sampleSite
+}
+
+type sampleKey struct {
+    pc    uintptr
+    level Level
+}
+
+type sampleSite struct {
+    window     time.Time // start of the current tick
+    n          int       // records in the current tick
+    tokens     float64
+    last       time.Time // last token refill
+    suppressed uint64    // dropped since the last emitted record
+}
+
+// new sampler, nil when sampling and rate limiting are both off
+func newSampler(s SamplingConfig) *sampler {
+    if s.Initial <= 0 && s.Thereafter <= 0 && s.Rate <= 0 {
+        return nil
+    }
+
+    if s.Initial < 0 || s.Thereafter < 0 || s.Burst < 0 {
+        panic("sampling Initial, Thereafter and Burst must not be negative")
+    }
+
+    if s.Tick <= 0 {
+        s.Tick = 1 * time.Second
+    }
+
+    if s.Burst == 0 {
+        s.Burst = int(s.Rate)
+        if s.Burst < 1 {
+            s.Burst = 1
+        }
+    }
+
+    if s.MaxLevel == LEVEL_DEBUG {
+        s.MaxLevel = LEVEL_WARN
+    }
+
+    sp := &sampler{SamplingConfig: s}
+    for i := range sp.shards {
+        sp.shards[i].sites = make(map[sampleKey]*sampleSite)
+    }
+
+    return sp
+}
+
+// whether the record of call site is emitted, and how many were dropped before it
+func (s *sampler) sample(pc uintptr, level Level, now time.Time) (bool, uint64) {
+    shard := &s.shards[(pc^pc>>10)%uintptr(len(s.shards))]
+    key := sampleKey{pc: pc, level: level}
+
+    shard.Lock()
+    defer shard.Unlock()
+
+    site := shard.sites[key]
+    if site == nil {
+        site = &sampleSite{window: now, tokens: float64(s.Burst), last: now}
+        shard.sites[key] = site
+    }
+
+    if now.Sub(site.window) >= s.Tick {
+        site.window = now
+        site.n = 0
+    }
+    site.n++
+
+    ok := true
+    if s.Initial > 0 || s.Thereafter > 0 {
+        ok = site.n <= s.Initial || s.Thereafter > 0 && (site.n-s.Initial)%s.Thereafter == 0
+    }
+
+    if ok && s.Rate > 0 {
+        site.tokens += now.Sub(site.last).Seconds() * s.Rate
+        if site.tokens > float64(s.Burst) {
+            site.tokens = float64(s.Burst)
+        }
+        site.last = now
+
+        if ok = site.tokens >= 1; ok {
+            site.tokens--
+        }
+    }
+
+    if !ok {
+        site.suppressed++
+        return false, 0
+    }
+
+    suppressed := site.suppressed
+    site.suppressed = 0
+
+    return true, suppressed
+}
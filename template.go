@@ -0,0 +1,220 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  template.go
+ * @version: 1.0.0
+ * @Date: 2026/10/25 下午3:20
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "fmt"
+    "os"
+    "runtime"
+    "strconv"
+    "strings"
+)
+
+/**
+ * 文本日志模板，New时编译
+ * 如 "{time} {level:5} {host} {pid}/{goroutine} {caller} {func} | {msg} {fields}"
+ * {msg} 之前的部分作为日志头，{fields} 必须在 {msg} 之后，没有 {fields} 时键值对紧跟在消息后
+ */
+
+const (
+    tmplText       = iota // literal text
+    tmplTime              // {time}, by TimeFormat
+    tmplLevel             // {level} or {level:5} padded to width
+    tmplHost              // {host}
+    tmplPid               // {pid}
+    tmplGoroutine         // {goroutine} goroutine id
+    tmplCaller            // {caller} file.go:12
+    tmplLongCaller        // {longcaller} /path/to/file.go:12
+    tmplFunc              // {func} pkg.(*T).Method
+    tmplName              // {name} LogConfig.Name
+)
+
+var tmplNames = map[string]int{
+    "time":       tmplTime,
+    "level":      tmplLevel,
+    "host":       tmplHost,
+    "pid":        tmplPid,
+    "goroutine":  tmplGoroutine,
+    "caller":     tmplCaller,
+    "longcaller": tmplLongCaller,
+    "func":       tmplFunc,
+    "name":       tmplName,
+}
+
+type tmplPart struct {
+    kind  int
+    text  string
+    width int
+}
+
+// compiled template split by {msg} and {fields}
+type headerTemplate struct {
+    head []tmplPart // before {msg}
+    mid  []tmplPart // between {msg} and {fields}
+    tail []tmplPart // after {fields}
+    host string
+}
+
+// compile template
+func parseTemplate(s string) (*headerTemplate, error) {
+    var (
+        t     = new(headerTemplate)
+        parts = &t.head
+        msg   bool
+    )
+
+    for len(s) > 0 {
+        i := strings.IndexByte(s, '{')
+        if i < 0 {
+            *parts = append(*parts, tmplPart{kind: tmplText, text: s})
+            break
+        }
+
+        if i > 0 {
+            *parts = append(*parts, tmplPart{kind: tmplText, text: s[:i]})
+        }
+
+        j := strings.IndexByte(s[i:], '}')
+        if j < 0 {
+            return nil, fmt.Errorf("unclosed placeholder: %q", s[i:])
+        }
+
+        name := s[i+1 : i+j]
+        s = s[i+j+1:]
+
+        switch name {
+        case "msg":
+            if msg {
+                return nil, fmt.Errorf("duplicate {msg}")
+            }
+            msg = true
+            parts = &t.mid
+            continue
+
+        case "fields":
+            if !msg {
+                return nil, fmt.Errorf("{fields} must be after {msg}")
+            }
+            parts = &t.tail
+            continue
+        }
+
+        var (
+            width int
+            err   error
+        )
+        if k := strings.IndexByte(name, ':'); k >= 0 {
+            if width, err = strconv.Atoi(name[k+1:]); err != nil || width <= 0 {
+                return nil, fmt.Errorf("invalid width: {%s}", name)
+            }
+            name = name[:k]
+        }
+
+        kind, ok := tmplNames[name]
+        if !ok {
+            return nil, fmt.Errorf("unknown placeholder: {%s}", name)
+        }
+
+        if kind == tmplHost {
+            t.host, _ = os.Hostname()
+        }
+
+        *parts = append(*parts, tmplPart{kind: kind, width: width})
+    }
+
+    return t, nil
+}
+
+// template needs the call site
+func (t *headerTemplate) needCaller() bool {
+    for _, parts := range [][]tmplPart{t.head, t.mid, t.tail} {
+        for _, p := range parts {
+            if p.kind == tmplCaller || p.kind == tmplLongCaller || p.kind == tmplFunc {
+                return true
+            }
+        }
+    }
+
+    return false
+}
+
+// append template parts
+func (c *Logger) appendTemplate(b []byte, parts []tmplPart, r logRecord, cl logCaller) []byte {
+    for _, p := range parts {
+        start := len(b)
+
+        switch p.kind {
+        case tmplText:
+            b = append(b, p.text...)
+        case tmplTime:
+            b = c.appendTimestamp(b, r.time)
+        case tmplLevel:
+            b = append(b, r.level.String()...)
+        case tmplHost:
+            b = append(b, c.template.host...)
+        case tmplPid:
+            b = strconv.AppendInt(b, int64(c.pid), 10)
+        case tmplGoroutine:
+            b = appendGoroutineID(b)
+        case tmplCaller, tmplLongCaller:
+            if p.kind == tmplCaller {
+                b = append(b, shortFile(cl.file)...)
+            } else {
+                b = append(b, cl.file...)
+            }
+            b = append(b, ':')
+            b = strconv.AppendInt(b, int64(cl.line), 10)
+        case tmplFunc:
+            b = append(b, shortFunc(cl.function)...)
+        case tmplName:
+            b = append(b, c.name...)
+        }
+
+        for n := len(b) - start; n < p.width; n++ {
+            b = append(b, ' ')
+        }
+    }
+
+    return b
+}
+
+// append current goroutine id from "goroutine 12 [running]:"
+func appendGoroutineID(b []byte) []byte {
+    var buf [64]byte
+
+    s := buf[:runtime.Stack(buf[:], false)]
+    s = s[len("goroutine "):]
+    for i, ch := range s {
+        if ch == ' ' {
+            return append(b, s[:i]...)
+        }
+    }
+
+    return b
+}
+
+// file name without directory
+func shortFile(file string) string {
+    for i := len(file) - 1; i > 0; i-- {
+        if file[i] == '/' {
+            return file[i+1:]
+        }
+    }
+
+    return file
+}
+
+// function name without package path, e.g. asynclog.(*Logger).Info
+func shortFunc(function string) string {
+    if i := strings.LastIndexByte(function, '/'); i >= 0 {
+        return function[i+1:]
+    }
+
+    return function
+}
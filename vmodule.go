@@ -0,0 +1,104 @@
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  vmodule.go
+ * @version: 1.0.0
+ * @Date: 2026/10/21 上午11:02
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "fmt"
+    "path"
+    "strings"
+)
+
+// vmodule rule, pattern is matched against the caller file without .go
+type vmoduleRule struct {
+    pattern string
+    parts   int // path components of pattern
+    level   Level
+}
+
+// cached vmodule result of a call site
+type vmoduleEntry struct {
+    pc      uintptr
+    level   Level
+    matched bool
+}
+
+// parse vmodule rules, e.g. "orders/*=debug,http=warn"
+// a pattern without '/' matches the file name, e.g. http matches .../http.go
+// a pattern with '/' matches the trailing path, e.g. orders/* matches .../orders/xxx.go
+func parseVModule(s string) ([]vmoduleRule, error) {
+    var rules []vmoduleRule
+
+    for _, item := range strings.Split(s, ",") {
+        item = strings.TrimSpace(item)
+        if item == "" {
+            continue
+        }
+
+        kv := strings.SplitN(item, "=", 2)
+        if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+            return nil, fmt.Errorf("invalid vmodule rule: %q", item)
+        }
+
+        pattern := strings.TrimSuffix(strings.TrimSpace(kv[0]), ".go")
+        if _, err := path.Match(pattern, ""); err != nil {
+            return nil, fmt.Errorf("invalid vmodule pattern: %q", kv[0])
+        }
+
+        level, err := ParseLevel(kv[1])
+        if err != nil {
+            return nil, err
+        }
+
+        rules = append(rules, vmoduleRule{
+            pattern: pattern,
+            parts:   strings.Count(pattern, "/") + 1,
+            level:   level,
+        })
+    }
+
+    return rules, nil
+}
+
+// match caller file, the first matched rule wins
+func matchVModule(rules []vmoduleRule, file string) (Level, bool) {
+    file = strings.TrimSuffix(file, ".go")
+
+    for _, rule := range rules {
+        // trailing rule.parts components of file
+        name := file
+        for i, n := len(file)-1, 0; i >= 0; i-- {
+            if file[i] == '/' {
+                n++
+                if n == rule.parts {
+                    name = file[i+1:]
+                    break
+                }
+            }
+        }
+
+        if ok, _ := path.Match(rule.pattern, name); ok {
+            return rule.level, true
+        }
+    }
+
+    return LEVEL_DEBUG, false
+}
+
+// vmodule level of call site, cached by pc
+func (c *Logger) vmoduleLevel(pc uintptr, file string) (Level, bool) {
+    slot := c.callSites.slot(pc)
+    if e, ok := slot.Load().(*vmoduleEntry); ok && e.pc == pc {
+        return e.level, e.matched
+    }
+
+    level, matched := matchVModule(c.vmodule, file)
+    slot.Store(&vmoduleEntry{pc: pc, level: level, matched: matched})
+
+    return level, matched
+}
@@ -0,0 +1,22 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  writev_other.go
+ * @version: 1.0.0
+ * @Date: 2026/10/23 下午3:40
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "net"
+    "os"
+)
+
+// write all buffers one by one, consumed buffers are removed from bufs
+func writeBuffers(f *os.File, bufs *net.Buffers) (int64, error) {
+    return bufs.WriteTo(f)
+}
@@ -0,0 +1,96 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+/**
+ * @Author: guomumin <aaron8573@gmail.com>
+ * @File:  writev_unix.go
+ * @version: 1.0.0
+ * @Date: 2026/10/23 下午3:40
+ * @Description:
+ */
+
+package asynclog
+
+import (
+    "io"
+    "net"
+    "os"
+    "syscall"
+    "unsafe"
+)
+
+const maxIovecs = 1024 // IOV_MAX
+
+// write all buffers with writev, consumed buffers are removed from bufs
+func writeBuffers(f *os.File, bufs *net.Buffers) (n int64, err error) {
+    rc, err := f.SyscallConn()
+    if err != nil {
+        return 0, err
+    }
+
+    iovs := make([]syscall.Iovec, 0, maxIovecs)
+
+    for len(*bufs) > 0 {
+        iovs = iovs[:0]
+        for _, b := range *bufs {
+            if len(b) == 0 {
+                continue
+            }
+
+            iovs = append(iovs, syscall.Iovec{Base: &b[0]})
+            iovs[len(iovs)-1].SetLen(len(b))
+            if len(iovs) == maxIovecs {
+                break
+            }
+        }
+
+        if len(iovs) == 0 {
+            *bufs = nil
+            return n, nil
+        }
+
+        var (
+            wrote uintptr
+            errno syscall.Errno
+        )
+
+        if err = rc.Write(func(fd uintptr) bool {
+            wrote, _, errno = syscall.Syscall(syscall.SYS_WRITEV, fd, uintptr(unsafe.Pointer(&iovs[0])), uintptr(len(iovs)))
+            return errno != syscall.EAGAIN
+        }); err != nil {
+            return n, err
+        }
+
+        if errno == syscall.EINTR {
+            continue
+        }
+
+        if errno != 0 {
+            return n, os.NewSyscallError("writev", errno)
+        }
+
+        if wrote == 0 {
+            return n, io.ErrShortWrite
+        }
+
+        n += int64(wrote)
+        consumeBuffers(bufs, int64(wrote))
+    }
+
+    return n, nil
+}
+
+// remove n written bytes from the head of bufs
+func consumeBuffers(bufs *net.Buffers, n int64) {
+    for len(*bufs) > 0 {
+        ln := int64(len((*bufs)[0]))
+        if ln > n {
+            (*bufs)[0] = (*bufs)[0][n:]
+            return
+        }
+
+        n -= ln
+        (*bufs)[0] = nil
+        *bufs = (*bufs)[1:]
+    }
+}